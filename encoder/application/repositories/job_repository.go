@@ -10,6 +10,9 @@ type JobRepository interface {
 	Insert(job *domain.Job) (*domain.Job, error)
 	Find(id string) (*domain.Job, error)
 	Update(job *domain.Job) (*domain.Job, error)
+	FindLast(resourceID string, filePath string, fingerprint string) (*domain.Job, error)
+	AddEvent(event *domain.JobEvent) error
+	Timeline(jobID string) ([]*domain.JobEvent, error)
 }
 
 type JobRepositoryDb struct {
@@ -33,10 +36,55 @@ func (repo *JobRepositoryDb) Find(id string) (*domain.Job, error) {
 	return &job, nil
 }
 
+// FindLast retorna o job mais recente, com o vídeo, criado para processar o arquivo
+// filePath do recurso resourceID a partir de um pedido com o fingerprint informado. Cabe a
+// quem chama decidir, pelo status, se o job pode ser retomado. Sem nenhum job, retorna
+// gorm.ErrRecordNotFound; os demais erros vêm do banco.
+func (repo *JobRepositoryDb) FindLast(resourceID string, filePath string, fingerprint string) (*domain.Job, error) {
+	var job domain.Job
+	err := repo.Db.Preload("Video").
+		Joins("JOIN videos ON videos.id = jobs.video_id").
+		Where("videos.resource_id = ? AND videos.file_path = ?", resourceID, filePath).
+		Where("jobs.request_fingerprint = ?", fingerprint).
+		Order("jobs.created_at desc").
+		First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Update grava o job, recusando com domain.ErrIllegalTransition uma mudança de status que
+// não parta do status persistido.
 func (repo *JobRepositoryDb) Update(job *domain.Job) (*domain.Job, error) {
-	err := repo.Db.Save(&job).Error
+	var current domain.Job
+	err := repo.Db.Select("status").First(&current, "id = ?", job.ID).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err = domain.ValidateTransition(current.Status, job.Status); err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.Db.Save(&job).Error
 	if err != nil {
 		return nil, err
 	}
 	return job, nil
 }
+
+func (repo *JobRepositoryDb) AddEvent(event *domain.JobEvent) error {
+	return repo.Db.Create(event).Error
+}
+
+// Timeline retorna os eventos de status do job em ordem cronológica.
+func (repo *JobRepositoryDb) Timeline(jobID string) ([]*domain.JobEvent, error) {
+	var events []*domain.JobEvent
+	err := repo.Db.Where("job_id = ?", jobID).Order("created_at").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -1,6 +1,7 @@
 package repositories_test
 
 import (
+	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/zemartins81/encoderVideoGolang/application/repositories"
@@ -23,7 +24,7 @@ func TestJobRepositoryDbInsert(t *testing.T) {
 	repo := repositories.VideoRepositoryDb{Db: db}
 	repo.Insert(video)
 
-	job, err := domain.NewJob("output_path", "Pending", video)
+	job, err := domain.NewJob("output_path", domain.JobStarting, video)
 	require.Nil(t, err)
 
 	repoJob := repositories.JobRepositoryDb{Db: db}
@@ -48,13 +49,13 @@ func TestJobRepositoryDbUpdate(t *testing.T) {
 	repo := repositories.VideoRepositoryDb{Db: db}
 	repo.Insert(video)
 
-	job, err := domain.NewJob("output_path", "Pending", video)
+	job, err := domain.NewJob("output_path", domain.JobStarting, video)
 	require.Nil(t, err)
 
 	repoJob := repositories.JobRepositoryDb{Db: db}
 	repoJob.Insert(job)
 
-	job.Status = "Complete"
+	job.Status = domain.JobDownloading
 	repoJob.Update(job)
 
 	j, err := repoJob.Find(job.ID)
@@ -62,3 +63,156 @@ func TestJobRepositoryDbUpdate(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, j.Status, job.Status)
 }
+
+func TestJobRepositoryDbPersistsPlaylists(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	repo := repositories.VideoRepositoryDb{Db: db}
+	repo.Insert(video)
+
+	job, err := domain.NewJob("output_path", domain.JobStarting, video)
+	require.Nil(t, err)
+	job.Packaging = domain.PackagingHLS
+	job.MasterPlaylist = video.ID + "/master.m3u8"
+	job.MediaPlaylists = domain.StringList{video.ID + "/media-1/stream.m3u8", video.ID + "/media-2/stream.m3u8"}
+
+	repoJob := repositories.JobRepositoryDb{Db: db}
+	_, err = repoJob.Insert(job)
+	require.Nil(t, err)
+
+	j, err := repoJob.Find(job.ID)
+	require.Nil(t, err)
+	require.Equal(t, domain.PackagingHLS, j.Packaging)
+	require.Equal(t, job.MasterPlaylist, j.MasterPlaylist)
+	require.Equal(t, job.MediaPlaylists, j.MediaPlaylists)
+}
+
+func TestJobRepositoryDbRefusesIllegalTransition(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	repo := repositories.VideoRepositoryDb{Db: db}
+	repo.Insert(video)
+
+	job, err := domain.NewJob("output_path", domain.JobFinishing, video)
+	require.Nil(t, err)
+
+	repoJob := repositories.JobRepositoryDb{Db: db}
+	_, err = repoJob.Insert(job)
+	require.Nil(t, err)
+
+	job.Status = domain.JobCompleted
+	_, err = repoJob.Update(job)
+	require.Nil(t, err)
+
+	job.Status = domain.JobDownloading
+	_, err = repoJob.Update(job)
+	require.ErrorIs(t, err, domain.ErrIllegalTransition)
+
+	j, err := repoJob.Find(job.ID)
+	require.Nil(t, err)
+	require.Equal(t, domain.JobCompleted, j.Status)
+}
+
+func TestJobRepositoryDbTimeline(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	repo := repositories.VideoRepositoryDb{Db: db}
+	repo.Insert(video)
+
+	job, err := domain.NewJob("output_path", domain.JobStarting, video)
+	require.Nil(t, err)
+
+	repoJob := repositories.JobRepositoryDb{Db: db}
+	_, err = repoJob.Insert(job)
+	require.Nil(t, err)
+
+	for _, status := range []domain.JobStatus{domain.JobDownloading, domain.JobFailed} {
+		previous := job.Status
+		require.Nil(t, job.TransitionTo(status))
+		event, err := domain.NewJobEvent(job, previous, time.Second, 3)
+		require.Nil(t, err)
+		require.Nil(t, repoJob.AddEvent(event))
+	}
+
+	events, err := repoJob.Timeline(job.ID)
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, domain.JobStarting, events[0].FromStatus)
+	require.Equal(t, domain.JobDownloading, events[0].Status)
+	require.Equal(t, domain.JobFailed, events[1].Status)
+	require.Equal(t, time.Second, events[1].Duration)
+	require.Equal(t, 3, events[1].WorkerID)
+
+	events, err = repoJob.Timeline(uuid.NewV4().String())
+	require.Nil(t, err)
+	require.Empty(t, events)
+}
+
+func TestJobRepositoryDbFindLast(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.ResourceID = "resource"
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	repo := repositories.VideoRepositoryDb{Db: db}
+	_, err := repo.Insert(video)
+	require.Nil(t, err)
+
+	repoJob := repositories.JobRepositoryDb{Db: db}
+	_, err = repoJob.FindLast("resource", "path", "fingerprint")
+	require.True(t, gorm.IsRecordNotFoundError(err))
+
+	job, err := domain.NewJob("output_path", domain.JobFailed, video)
+	require.Nil(t, err)
+	job.CompletedStages = domain.StringList{domain.StageDownloaded}
+	job.RequestFingerprint = "fingerprint"
+	_, err = repoJob.Insert(job)
+	require.Nil(t, err)
+
+	j, err := repoJob.FindLast("resource", "path", "fingerprint")
+	require.Nil(t, err)
+	require.Equal(t, job.ID, j.ID)
+	require.Equal(t, video.ID, j.Video.ID)
+	require.Equal(t, job.CompletedStages, j.CompletedStages)
+
+	_, err = repoJob.FindLast("resource", "other", "fingerprint")
+	require.Error(t, err)
+
+	_, err = repoJob.FindLast("resource", "path", "other")
+	require.Error(t, err)
+
+	cancelled, err := domain.NewJob("output_path", domain.JobCancelled, video)
+	require.Nil(t, err)
+	cancelled.RequestFingerprint = "fingerprint"
+	cancelled.CreatedAt = job.CreatedAt.Add(time.Minute)
+	_, err = repoJob.Insert(cancelled)
+	require.Nil(t, err)
+
+	// O job cancelado, mais recente, esconde o que falhou antes dele.
+	j, err = repoJob.FindLast("resource", "path", "fingerprint")
+	require.Nil(t, err)
+	require.Equal(t, cancelled.ID, j.ID)
+	require.Equal(t, domain.JobCancelled, j.Status)
+}
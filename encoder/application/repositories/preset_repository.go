@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+// ErrPresetNotFound é retornado por FindByName quando não há preset com o nome informado.
+var ErrPresetNotFound = errors.New("preset not found")
+
+type PresetRepository interface {
+	Insert(preset *domain.Preset) (*domain.Preset, error)
+	Find(id string) (*domain.Preset, error)
+	FindByName(name string) (*domain.Preset, error)
+}
+
+type PresetRepositoryDb struct {
+	Db *gorm.DB
+}
+
+func NewPresetRepositoryDb(db *gorm.DB) *PresetRepositoryDb {
+	return &PresetRepositoryDb{Db: db}
+}
+
+func (repo *PresetRepositoryDb) Insert(preset *domain.Preset) (*domain.Preset, error) {
+	err := preset.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Db.Create(preset).Error
+	if err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+func (repo *PresetRepositoryDb) Find(id string) (*domain.Preset, error) {
+	var preset domain.Preset
+	repo.Db.First(&preset, "id = ?", id)
+	if preset.ID == "" {
+		return nil, fmt.Errorf("preset not found")
+	}
+	return &preset, nil
+}
+
+func (repo *PresetRepositoryDb) FindByName(name string) (*domain.Preset, error) {
+	var preset domain.Preset
+	repo.Db.First(&preset, "name = ?", name)
+	if preset.ID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrPresetNotFound, name)
+	}
+	return &preset, nil
+}
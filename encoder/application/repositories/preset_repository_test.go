@@ -0,0 +1,48 @@
+package repositories_test
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/database"
+	"testing"
+)
+
+func TestPresetRepositoryDbInsert(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	preset, err := domain.NewPreset("web-hd", domain.DefaultRenditions())
+	require.Nil(t, err)
+	preset.Packaging = domain.PackagingDASHHLS
+
+	repo := repositories.NewPresetRepositoryDb(db)
+	_, err = repo.Insert(preset)
+	require.Nil(t, err)
+
+	p, err := repo.Find(preset.ID)
+	require.Nil(t, err)
+	require.Equal(t, preset.Name, p.Name)
+	require.Equal(t, preset.Renditions, p.Renditions)
+
+	p, err = repo.FindByName("web-hd")
+	require.Nil(t, err)
+	require.Equal(t, preset.ID, p.ID)
+	require.Equal(t, domain.PackagingDASHHLS, p.Packaging)
+
+	_, err = repo.FindByName("mobile")
+	require.Error(t, err)
+}
+
+func TestPresetRepositoryDbInsertInvalid(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	preset, err := domain.NewPreset("web-hd", domain.DefaultRenditions())
+	require.Nil(t, err)
+	preset.SegmentDuration = 0
+
+	repo := repositories.NewPresetRepositoryDb(db)
+	_, err = repo.Insert(preset)
+	require.Error(t, err)
+}
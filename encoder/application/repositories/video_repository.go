@@ -10,6 +10,7 @@ import (
 type VideoRepository interface {
 	Insert(video *domain.Video) (*domain.Video, error)
 	Find(id string) (*domain.Video, error)
+	Update(video *domain.Video) (*domain.Video, error)
 }
 
 type VideoRepositoryDb struct {
@@ -41,3 +42,11 @@ func (repo *VideoRepositoryDb) Find(id string) (*domain.Video, error) {
 
 	return &video, nil
 }
+
+func (repo *VideoRepositoryDb) Update(video *domain.Video) (*domain.Video, error) {
+	err := repo.Db.Save(video).Error
+	if err != nil {
+		return nil, err
+	}
+	return video, nil
+}
@@ -31,3 +31,49 @@ func TestNewVideoRepositoryDbInsert(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, v.ID, video.ID)
 }
+
+func TestVideoRepositoryDbUpdate(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	repo := repositories.NewVideoRepositoryDb(db)
+	_, err := repo.Insert(video)
+	require.Nil(t, err)
+
+	video.Duration = 12.5
+	video.Width = 1920
+	video.Height = 1080
+	video.VideoCodec = "h264"
+	_, err = repo.Update(video)
+	require.Nil(t, err)
+
+	v, err := repo.Find(video.ID)
+	require.Nil(t, err)
+	require.Equal(t, 12.5, v.Duration)
+	require.Equal(t, 1080, v.Height)
+	require.Equal(t, "h264", v.VideoCodec)
+}
+
+func TestVideoRepositoryDbPersistsCaptions(t *testing.T) {
+	db := database.NewDbTest()
+	defer db.Close()
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.Captions = domain.Captions{{Language: "pt-BR", FilePath: "subs/pt.srt"}}
+	video.CreatedAt = time.Now()
+
+	repo := repositories.NewVideoRepositoryDb(db)
+	_, err := repo.Insert(video)
+	require.Nil(t, err)
+
+	v, err := repo.Find(video.ID)
+	require.Nil(t, err)
+	require.Equal(t, video.Captions, v.Captions)
+}
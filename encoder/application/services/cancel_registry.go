@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pendingCancelTTL é por quanto tempo um cancelamento de um job que não está em andamento
+// é lembrado, cobrindo o intervalo entre a criação ou retomada do job e o início do seu
+// processamento.
+const pendingCancelTTL = time.Minute
+
+// CancelRegistry associa os jobs em andamento nesta instância às funções que cancelam
+// seus contextos, permitindo interrompê-los por ID.
+type CancelRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+	pending map[string]time.Time
+}
+
+func NewCancelRegistry() *CancelRegistry {
+	return &CancelRegistry{
+		cancels: map[string]context.CancelCauseFunc{},
+		pending: map[string]time.Time{},
+	}
+}
+
+// Track retorna um contexto derivado de ctx que é cancelado por Cancel(jobID), e a função
+// que remove o job do registro ao fim do processamento. Se o job foi cancelado há pouco,
+// antes de começar, o contexto já é retornado cancelado.
+func (r *CancelRegistry) Track(ctx context.Context, jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	r.cancels[jobID] = cancel
+	if cancelledAt, ok := r.pending[jobID]; ok {
+		delete(r.pending, jobID)
+		if time.Since(cancelledAt) < pendingCancelTTL {
+			cancel(nil)
+		}
+	}
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels, jobID)
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Cancel cancela o job, informando se ele estava em andamento nesta instância. Se não
+// estava, o cancelamento é lembrado por pendingCancelTTL e aplicado caso o job comece nesse
+// intervalo.
+func (r *CancelRegistry) Cancel(jobID string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[jobID]
+	if !ok {
+		r.prunePending()
+		r.pending[jobID] = time.Now()
+	}
+	r.mu.Unlock()
+
+	if ok {
+		cancel(nil)
+	}
+	return ok
+}
+
+// CancelAll cancela todos os jobs em andamento com a causa informada, que context.Cause
+// retorna nos seus contextos, e informa quantos foram cancelados.
+func (r *CancelRegistry) CancelAll(cause error) int {
+	r.mu.Lock()
+	cancels := make([]context.CancelCauseFunc, 0, len(r.cancels))
+	for _, cancel := range r.cancels {
+		cancels = append(cancels, cancel)
+	}
+	r.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel(cause)
+	}
+	return len(cancels)
+}
+
+// Running retorna os IDs dos jobs em andamento.
+func (r *CancelRegistry) Running() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, 0, len(r.cancels))
+	for id := range r.cancels {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// prunePending esquece os cancelamentos pendentes expirados. Deve ser chamada com mu
+// travado.
+func (r *CancelRegistry) prunePending() {
+	for jobID, cancelledAt := range r.pending {
+		if time.Since(cancelledAt) >= pendingCancelTTL {
+			delete(r.pending, jobID)
+		}
+	}
+}
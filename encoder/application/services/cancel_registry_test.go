@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+)
+
+func TestCancelRegistry(t *testing.T) {
+	registry := services.NewCancelRegistry()
+
+	ctx, untrack := registry.Track(context.Background(), "job-1")
+	require.Equal(t, []string{"job-1"}, registry.Running())
+	require.False(t, registry.Cancel("job-2"))
+	require.Nil(t, ctx.Err())
+
+	require.True(t, registry.Cancel("job-1"))
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	untrack()
+	require.Empty(t, registry.Running())
+	require.False(t, registry.Cancel("job-1"))
+}
+
+func TestCancelRegistryCancelAll(t *testing.T) {
+	registry := services.NewCancelRegistry()
+
+	first, untrackFirst := registry.Track(context.Background(), "job-1")
+	defer untrackFirst()
+	second, untrackSecond := registry.Track(context.Background(), "job-2")
+	defer untrackSecond()
+
+	require.Equal(t, 2, registry.CancelAll(services.ErrShutdown))
+	require.ErrorIs(t, first.Err(), context.Canceled)
+	require.ErrorIs(t, second.Err(), context.Canceled)
+	require.ErrorIs(t, context.Cause(first), services.ErrShutdown)
+}
+
+func TestCancelRegistryCancelsJobBeforeItStarts(t *testing.T) {
+	registry := services.NewCancelRegistry()
+
+	require.False(t, registry.Cancel("job-1"))
+
+	ctx, untrack := registry.Track(context.Background(), "job-1")
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+	untrack()
+
+	// O cancelamento pendente só vale uma vez.
+	ctx, untrack = registry.Track(context.Background(), "job-1")
+	defer untrack()
+	require.Nil(t, ctx.Err())
+}
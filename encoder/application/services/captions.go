@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+// Cue é um trecho de legenda com seu intervalo de exibição.
+type Cue struct {
+	Start    time.Duration
+	End      time.Duration
+	Settings string
+	Lines    []string
+}
+
+var cueMarkup = regexp.MustCompile(`<[^>]*>`)
+
+// ParseCues lê as legendas de um arquivo SRT ou WebVTT. Blocos sem linha de tempo, como
+// o cabeçalho WEBVTT e blocos NOTE ou STYLE, são ignorados.
+func ParseCues(r io.Reader) ([]Cue, error) {
+	var cues []Cue
+	var block []string
+
+	flush := func() error {
+		defer func() { block = nil }()
+
+		for i, line := range block {
+			if !strings.Contains(line, "-->") {
+				continue
+			}
+			cue, err := parseCueTiming(line)
+			if err != nil {
+				return err
+			}
+			cue.Lines = append(cue.Lines, block[i+1:]...)
+			cues = append(cues, cue)
+			return nil
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return cues, nil
+}
+
+// parseCueTiming lê uma linha "00:00:01,000 --> 00:00:04,000" com as configurações de
+// posicionamento opcionais do WebVTT.
+func parseCueTiming(line string) (Cue, error) {
+	var cue Cue
+
+	parts := strings.SplitN(line, "-->", 2)
+	end := strings.Fields(parts[1])
+	if len(end) == 0 {
+		return cue, fmt.Errorf("invalid cue timing %q", line)
+	}
+
+	var err error
+	if cue.Start, err = parseCueTimestamp(strings.TrimSpace(parts[0])); err != nil {
+		return cue, err
+	}
+	if cue.End, err = parseCueTimestamp(end[0]); err != nil {
+		return cue, err
+	}
+	if cue.End < cue.Start {
+		return cue, fmt.Errorf("invalid cue timing %q: ends before it starts", line)
+	}
+	cue.Settings = strings.Join(end[1:], " ")
+
+	return cue, nil
+}
+
+// parseCueTimestamp lê um instante nos formatos hh:mm:ss,mmm (SRT), hh:mm:ss.mmm ou
+// mm:ss.mmm (WebVTT).
+func parseCueTimestamp(s string) (time.Duration, error) {
+	fields := strings.Split(strings.Replace(s, ",", ".", 1), ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("invalid cue timestamp %q", s)
+	}
+
+	seconds, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cue timestamp %q", s)
+	}
+
+	var total float64
+	for _, field := range fields[:len(fields)-1] {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cue timestamp %q", s)
+		}
+		total = total*60 + float64(n)
+	}
+	total = total*60 + seconds
+
+	return time.Duration(total*1000+0.5) * time.Millisecond, nil
+}
+
+// WriteWebVTT grava as legendas no formato WebVTT.
+func WriteWebVTT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "WEBVTT\n")
+
+	for _, cue := range cues {
+		fmt.Fprintf(bw, "\n%s --> %s", vttTimestamp(cue.Start.Seconds()), vttTimestamp(cue.End.Seconds()))
+		if cue.Settings != "" {
+			fmt.Fprintf(bw, " %s", cue.Settings)
+		}
+		fmt.Fprint(bw, "\n")
+		for _, line := range cue.Lines {
+			fmt.Fprintf(bw, "%s\n", line)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteTTML grava as legendas no formato TTML, removendo as marcações de estilo do texto.
+func WriteTTML(w io.Writer, cues []Cue, language string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, xml.Header)
+	fmt.Fprintf(bw, "<tt xmlns=\"http://www.w3.org/ns/ttml\" xml:lang=\"%s\">\n", language)
+	fmt.Fprint(bw, "  <body>\n    <div>\n")
+
+	for _, cue := range cues {
+		fmt.Fprintf(bw, "      <p begin=\"%s\" end=\"%s\">", vttTimestamp(cue.Start.Seconds()), vttTimestamp(cue.End.Seconds()))
+		for i, line := range cue.Lines {
+			if i > 0 {
+				fmt.Fprint(bw, "<br/>")
+			}
+			if err := xml.EscapeText(bw, []byte(cueMarkup.ReplaceAllString(line, ""))); err != nil {
+				return err
+			}
+		}
+		fmt.Fprint(bw, "</p>\n")
+	}
+
+	fmt.Fprint(bw, "    </div>\n  </body>\n</tt>\n")
+	return bw.Flush()
+}
+
+// DownloadCaptions baixa as legendas do vídeo para o diretório <id>_captions e as
+// converte para o formato informado (WebVTT ou TTML), gravando um arquivo <idioma>.vtt
+// ou <idioma>.ttml por idioma.
+func (v *VideoService) DownloadCaptions(ctx context.Context, bucketName string, format string) error {
+	if len(v.Video.Captions) == 0 {
+		return nil
+	}
+
+	dir := v.captionsDir()
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, caption := range v.Video.Captions {
+		cues, err := v.downloadCues(ctx, bucketName, caption)
+		if err != nil {
+			return fmt.Errorf("error downloading caption %s: %w", caption.Language, err)
+		}
+
+		ext := ".vtt"
+		if format == domain.CaptionFormatTTML {
+			ext = ".ttml"
+		}
+
+		f, err := os.Create(filepath.Join(dir, caption.Language+ext))
+		if err != nil {
+			return err
+		}
+
+		if format == domain.CaptionFormatTTML {
+			err = WriteTTML(f, cues, caption.Language)
+		} else {
+			err = WriteWebVTT(f, cues)
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downloadCues lê as legendas do bucket, conferindo os checksums do objeto baixado.
+func (v *VideoService) downloadCues(ctx context.Context, bucketName string, caption domain.Caption) ([]Cue, error) {
+	info, err := v.Store.Stat(ctx, bucketName, caption.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := v.Store.Get(ctx, bucketName, caption.FilePath, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	h := storage.NewHasher()
+	cues, err := ParseCues(io.TeeReader(r, h))
+	if err != nil {
+		return nil, err
+	}
+
+	// Consome o restante do objeto para que o checksum cubra o arquivo inteiro.
+	if _, err = io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	if err = info.Verify(h); err != nil {
+		return nil, err
+	}
+
+	return cues, nil
+}
+
+// captionsDir retorna o diretório local das legendas convertidas do vídeo.
+func (v *VideoService) captionsDir() string {
+	return v.renditionPath("captions")
+}
+
+// captionInputs retorna as legendas convertidas no formato de entrada do mp4dash e do
+// mp4hls, como "[+format=webvtt,+language=pt-BR]<id>_captions/pt-BR.vtt".
+func (v *VideoService) captionInputs() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(v.captionsDir(), "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var inputs []string
+	for _, file := range files {
+		ext := filepath.Ext(file)
+		language := strings.TrimSuffix(filepath.Base(file), ext)
+
+		format := domain.CaptionFormatWebVTT
+		if ext == ".ttml" {
+			format = domain.CaptionFormatTTML
+		}
+		inputs = append(inputs, fmt.Sprintf("[+format=%s,+language=%s]%s", format, language, file))
+	}
+
+	return inputs, nil
+}
@@ -0,0 +1,84 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+const sampleSRT = "\ufeff1\r\n00:00:01,000 --> 00:00:04,500\r\nOlá, <i>mundo</i>!\r\nSegunda linha\r\n\r\n2\r\n00:01:02,250 --> 00:01:05,000\r\nA & B\r\n"
+
+func TestSRTToWebVTT(t *testing.T) {
+	cues, err := services.ParseCues(strings.NewReader(sampleSRT))
+	require.Nil(t, err)
+	require.Len(t, cues, 2)
+
+	var vtt strings.Builder
+	require.Nil(t, services.WriteWebVTT(&vtt, cues))
+	require.Equal(t, "WEBVTT\n"+
+		"\n00:00:01.000 --> 00:00:04.500\nOlá, <i>mundo</i>!\nSegunda linha\n"+
+		"\n00:01:02.250 --> 00:01:05.000\nA & B\n", vtt.String())
+}
+
+func TestParseWebVTTCues(t *testing.T) {
+	input := "WEBVTT\n\nNOTE comentário\n\nintro\n00:05.000 --> 00:07.000 align:start\nOi\n"
+
+	cues, err := services.ParseCues(strings.NewReader(input))
+	require.Nil(t, err)
+	require.Len(t, cues, 1)
+	require.Equal(t, "align:start", cues[0].Settings)
+	require.Equal(t, []string{"Oi"}, cues[0].Lines)
+	require.Equal(t, 5.0, cues[0].Start.Seconds())
+}
+
+func TestParseCuesRejectsInvalidTiming(t *testing.T) {
+	_, err := services.ParseCues(strings.NewReader("1\n00:00:04,000 --> 00:00:01,000\nx\n"))
+	require.Error(t, err)
+
+	_, err = services.ParseCues(strings.NewReader("1\n00:aa:04,000 --> 00:00:05,000\nx\n"))
+	require.Error(t, err)
+}
+
+func TestSRTToTTML(t *testing.T) {
+	cues, err := services.ParseCues(strings.NewReader(sampleSRT))
+	require.Nil(t, err)
+
+	var ttml strings.Builder
+	require.Nil(t, services.WriteTTML(&ttml, cues, "pt-BR"))
+	require.Contains(t, ttml.String(), `xml:lang="pt-BR"`)
+	require.Contains(t, ttml.String(), `<p begin="00:00:01.000" end="00:00:04.500">Olá, mundo!<br/>Segunda linha</p>`)
+	require.Contains(t, ttml.String(), `A &amp; B`)
+}
+
+func TestVideoServiceDownloadCaptions(t *testing.T) {
+	video, repo := prepare(t)
+	video.Captions = domain.Captions{{Language: "pt-BR", FilePath: "subs/pt.srt"}}
+
+	store := prepareStore(t, []byte("video content"))
+	err := store.Put(context.Background(), "encodervideotest", "subs/pt.srt", strings.NewReader(sampleSRT), storage.PutOptions{})
+	require.Nil(t, err)
+
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	videoService.Store = store
+
+	err = videoService.DownloadCaptions(context.Background(), "encodervideotest", domain.CaptionFormatWebVTT)
+	require.Nil(t, err)
+
+	content, err := os.ReadFile(filepath.Join(os.Getenv("localStoragePath"), video.ID+"_captions", "pt-BR.vtt"))
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(string(content), "WEBVTT\n\n00:00:01.000 --> 00:00:04.500\n"))
+
+	err = videoService.DownloadCaptions(context.Background(), "encodervideotest", domain.CaptionFormatTTML)
+	require.Nil(t, err)
+	_, err = os.Stat(filepath.Join(os.Getenv("localStoragePath"), video.ID+"_captions", "pt-BR.ttml"))
+	require.Nil(t, err)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+// VerifyDownload confere se o vídeo baixado em uma execução anterior ainda corresponde ao
+// objeto do bucket de entrada e se as legendas convertidas continuam no workspace.
+func (v *VideoService) VerifyDownload(ctx context.Context, bucketName string) error {
+	info, err := v.Store.Stat(ctx, bucketName, v.Video.FilePath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(os.Getenv("localStoragePath") + "/" + v.Video.ID + ".mp4")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h, err := storage.HashReader(f)
+	if err != nil {
+		return err
+	}
+	if err = info.Verify(h); err != nil {
+		return err
+	}
+
+	captions, err := filepath.Glob(filepath.Join(v.captionsDir(), "*"))
+	if err != nil {
+		return err
+	}
+	if len(captions) != len(v.Video.Captions) {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
+
+// Transcoded informa se os MP4s de todas as renditions do job estão no workspace.
+func (v *VideoService) Transcoded(job *domain.Job) bool {
+	return v.renditionsExist(job, ".mp4")
+}
+
+// Fragmented informa se os arquivos fragmentados de todas as renditions do job estão no
+// workspace.
+func (v *VideoService) Fragmented(job *domain.Job) bool {
+	return v.renditionsExist(job, ".frag")
+}
+
+// Encoded informa se o manifesto ou a playlist principal registrados no job estão no
+// workspace.
+func (v *VideoService) Encoded(job *domain.Job) bool {
+	if job.ManifestPath == "" && job.MasterPlaylist == "" {
+		return false
+	}
+	return (job.ManifestPath == "" || workspaceFileExists(job.ManifestPath)) &&
+		(job.MasterPlaylist == "" || workspaceFileExists(job.MasterPlaylist))
+}
+
+func (v *VideoService) renditionsExist(job *domain.Job, ext string) bool {
+	if job.Preset == nil || len(job.Preset.Renditions) == 0 {
+		return false
+	}
+	for _, rendition := range v.renditionsFor(job.Preset) {
+		if !fileExists(v.renditionPath(rendition.Name) + ext) {
+			return false
+		}
+	}
+	return true
+}
+
+// workspaceFileExists informa se o objeto de saída, identificado pelo caminho relativo a
+// localStoragePath, ainda está no workspace.
+func workspaceFileExists(key string) bool {
+	return key != "" && fileExists(filepath.Join(os.Getenv("localStoragePath"), filepath.FromSlash(key)))
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,102 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+// prepareResume cria um job que falhou com as etapas informadas concluídas e o vídeo
+// local com o conteúdo local, enquanto o bucket de entrada guarda "video content".
+func prepareResume(t *testing.T, local string, stages ...string) *services.JobService {
+	t.Setenv("INPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("SPRITE_INTERVAL", "")
+
+	jobService := prepareJobService(t)
+	jobService.VideoService.Video = jobService.Job.Video
+	jobService.VideoService.Video.Duration = 10
+	jobService.VideoService.Store = prepareStore(t, []byte("video content"))
+	jobService.VideoService.VideoRepository = nil
+	require.Nil(t, jobService.ApplyPreset())
+
+	jobService.Job.CompletedStages = stages
+	jobService.Job.Status = domain.JobFailed
+	_, err := jobService.JobRepository.Insert(jobService.Job)
+	require.Nil(t, err)
+	require.Nil(t, jobService.Job.TransitionTo(domain.JobStarting))
+	_, err = jobService.JobRepository.Update(jobService.Job)
+	require.Nil(t, err)
+
+	err = os.WriteFile(os.Getenv("localStoragePath")+"/"+jobService.Job.Video.ID+".mp4", []byte(local), 0644)
+	require.Nil(t, err)
+
+	return jobService
+}
+
+func timelineStatuses(t *testing.T, jobService *services.JobService) []domain.JobStatus {
+	events, err := jobService.JobRepository.Timeline(jobService.Job.ID)
+	require.Nil(t, err)
+
+	var statuses []domain.JobStatus
+	for _, event := range events {
+		statuses = append(statuses, event.Status)
+	}
+	return statuses
+}
+
+func TestJobServiceResumesFromLastValidStage(t *testing.T) {
+	jobService := prepareResume(t, "video content", domain.StageDownloaded, domain.StageProbed, domain.StageTranscoded)
+
+	// Os MP4s das renditions não estão no workspace, então a transcodificação é refeita
+	// e falha com o vídeo de teste inválido.
+	err := jobService.Start(context.Background())
+	require.Error(t, err)
+
+	require.Equal(t, domain.JobFailed, jobService.Job.Status)
+	require.Equal(t, domain.StringList{domain.StageDownloaded, domain.StageProbed}, jobService.Job.CompletedStages)
+	require.Equal(t, []domain.JobStatus{domain.JobDownloading, domain.JobProbing, domain.JobTranscoding, domain.JobFailed}, timelineStatuses(t, jobService))
+}
+
+func TestJobServiceRedownloadsInvalidWorkspace(t *testing.T) {
+	jobService := prepareResume(t, "stale content", domain.StageDownloaded, domain.StageProbed)
+
+	err := jobService.Start(context.Background())
+	require.Error(t, err)
+
+	content, err := os.ReadFile(os.Getenv("localStoragePath") + "/" + jobService.Job.Video.ID + ".mp4")
+	require.Nil(t, err)
+	require.Equal(t, "video content", string(content))
+	require.Equal(t, domain.StringList{domain.StageDownloaded}, jobService.Job.CompletedStages)
+}
+
+func TestJobServiceResumeAfterUploadOnlyFinishes(t *testing.T) {
+	jobService := prepareResume(t, "stale content",
+		domain.StageDownloaded, domain.StageProbed, domain.StageTranscoded, domain.StageFragmented,
+		domain.StageEncoded, domain.StageThumbnails, domain.StageUploaded)
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest-output")
+	jobService.OutputStore = storage.NewLocalStore(t.TempDir())
+	manifest := jobService.Job.Video.ID + "/stream.mpd"
+	err := jobService.OutputStore.Put(context.Background(), "encodervideotest-output", manifest, strings.NewReader("mpd"), storage.PutOptions{})
+	require.Nil(t, err)
+
+	err = jobService.Start(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, domain.JobCompleted, jobService.Job.Status)
+
+	// O relatório de upload é refeito a partir do bucket de saída.
+	objects := jobService.UploadReport.Objects()
+	require.Len(t, objects, 1)
+	require.Equal(t, manifest, objects[0].Key)
+	require.Equal(t, int64(3), objects[0].Size)
+	require.True(t, objects[0].Skipped)
+
+	_, err = os.Stat(os.Getenv("localStoragePath") + "/" + jobService.Job.Video.ID + ".mp4")
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// commandWaitDelay é quanto tempo, após o cancelamento, se espera pelo fechamento da saída
+// do comando antes de desistir dela.
+const commandWaitDelay = 5 * time.Second
+
+// command prepara um comando externo que é encerrado junto com ctx. Em sistemas Unix o
+// comando roda em um grupo de processos próprio, e o grupo inteiro é encerrado, incluindo
+// os processos que ele iniciar, como os binários do Bento4 chamados pelo mp4dash.
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = commandWaitDelay
+	killProcessGroup(cmd)
+	return cmd
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandKillsChildProcesses(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found in PATH")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// O filho "sleep" herda a saída do shell; se sobrevivesse ao cancelamento,
+	// CombinedOutput só retornaria depois de WaitDelay.
+	started := time.Now()
+	_, err := command(ctx, "sh", "-c", "sleep 30; echo done").CombinedOutput()
+	require.Error(t, err)
+	require.Less(t, time.Since(started), commandWaitDelay)
+}
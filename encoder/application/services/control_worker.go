@@ -0,0 +1,89 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+// CommandCancel interrompe o job indicado.
+const CommandCancel = "cancel"
+
+// ControlCommand é uma mensagem da fila de controle, como {"command": "cancel", "job_id": "..."}.
+type ControlCommand struct {
+	Command string `json:"command"`
+	JobID   string `json:"job_id"`
+}
+
+// ControlWorker executa os comandos recebidos da fila de controle. Como o comando é
+// entregue a todas as instâncias, cada uma cancela os jobs em andamento nela. Um job que
+// falhou e aguarda uma nova tentativa é marcado como CANCELLED em jobRepository, para que
+// não seja retomado.
+func ControlWorker(controlChannel chan amqp.Delivery, cancellations *CancelRegistry, jobRepository repositories.JobRepository) {
+	for message := range controlChannel {
+		err := handleControlCommand(message.Body, cancellations, jobRepository)
+		if err != nil {
+			log.Printf("invalid control command %q: %v", message.Body, err)
+		}
+	}
+}
+
+func handleControlCommand(body []byte, cancellations *CancelRegistry, jobRepository repositories.JobRepository) error {
+	var command ControlCommand
+	err := json.Unmarshal(body, &command)
+	if err != nil {
+		return err
+	}
+
+	switch command.Command {
+	case CommandCancel:
+		if command.JobID == "" {
+			return fmt.Errorf("job_id is required")
+		}
+		if cancellations.Cancel(command.JobID) {
+			log.Printf("job %v cancelled", command.JobID)
+			return nil
+		}
+		if jobRepository != nil {
+			cancelWaitingJob(jobRepository, command.JobID)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q", command.Command)
+}
+
+// cancelWaitingJob marca como CANCELLED o job que falhou ou estourou o tempo limite e
+// aguarda uma nova tentativa. Jobs em andamento em outra instância são cancelados por ela.
+func cancelWaitingJob(jobRepository repositories.JobRepository, jobID string) {
+	job, err := jobRepository.Find(jobID)
+	if err != nil || (job.Status != domain.JobFailed && job.Status != domain.JobTimedOut) {
+		return
+	}
+
+	previous, stoppedAt := job.Status, job.UpdatedAt
+	if err = job.TransitionTo(domain.JobCancelled); err != nil {
+		return
+	}
+	job.Error = "cancelled while waiting for a retry"
+
+	_, err = jobRepository.Update(job)
+	if err != nil {
+		log.Printf("error cancelling job %v: %v", jobID, err)
+		return
+	}
+	log.Printf("job %v cancelled", jobID)
+
+	event, err := domain.NewJobEvent(job, previous, time.Since(stoppedAt), 0)
+	if err == nil {
+		err = jobRepository.AddEvent(event)
+	}
+	if err != nil {
+		log.Printf("error recording %s event for job %v: %v", job.Status, job.ID, err)
+	}
+}
@@ -0,0 +1,78 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/queue"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+func TestControlWorkerCancelsJob(t *testing.T) {
+	registry := services.NewCancelRegistry()
+	ctx, untrack := registry.Track(context.Background(), "job-1")
+	defer untrack()
+	other, untrackOther := registry.Track(context.Background(), "job-2")
+	defer untrackOther()
+
+	controlChannel := make(chan amqp.Delivery)
+	done := make(chan struct{})
+	go func() {
+		services.ControlWorker(controlChannel, registry, nil)
+		close(done)
+	}()
+
+	controlChannel <- amqp.Delivery{Body: []byte(`not json`)}
+	controlChannel <- amqp.Delivery{Body: []byte(`{"command": "pause", "job_id": "job-1"}`)}
+	controlChannel <- amqp.Delivery{Body: []byte(`{"command": "cancel", "job_id": "unknown"}`)}
+	controlChannel <- amqp.Delivery{Body: []byte(`{"command": "cancel", "job_id": "job-1"}`)}
+	close(controlChannel)
+	<-done
+
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+	require.Nil(t, other.Err())
+}
+
+func TestControlWorkerCancelsJobWaitingForRetry(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("INPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("RESUME_FAILED_JOBS", "")
+
+	// O arquivo não existe no bucket, então o job falha no download.
+	factory := prepareJobServiceFactory(t, storage.NewLocalStore(t.TempDir()))
+	request := `{"resource_id": "resource", "file_path": "emilly.mp4"}`
+
+	failed := processOne(factory, request)
+	require.Equal(t, domain.JobFailed, failed.Job.Status)
+
+	controlChannel := make(chan amqp.Delivery, 1)
+	controlChannel <- amqp.Delivery{Body: []byte(`{"command": "cancel", "job_id": "` + failed.Job.ID + `"}`)}
+	close(controlChannel)
+	services.ControlWorker(controlChannel, services.NewCancelRegistry(), factory.JobRepository)
+
+	job, err := factory.JobRepository.Find(failed.Job.ID)
+	require.Nil(t, err)
+	require.Equal(t, domain.JobCancelled, job.Status)
+
+	// A nova tentativa do job cancelado não é processada.
+	messageChannel := make(chan amqp.Delivery, 1)
+	returnChannel := make(chan services.JobWorkerResult, 1)
+	messageChannel <- amqp.Delivery{Body: []byte(request), Headers: amqp.Table{queue.HeaderAttempts: int32(1)}}
+	close(messageChannel)
+	services.JobWorker(messageChannel, returnChannel, factory, 0)
+
+	retried := <-returnChannel
+	require.ErrorIs(t, retried.Error, services.ErrJobCancelled)
+	require.Equal(t, failed.Job.ID, retried.Job.ID)
+	require.Equal(t, domain.JobCancelled, retried.Job.Status)
+
+	// Um pedido novo com as mesmas opções cria outro job.
+	fresh := processOne(factory, request)
+	require.NotEqual(t, failed.Job.ID, fresh.Job.ID)
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/jinzhu/gorm"
+	"github.com/streadway/amqp"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/drm"
+	"github.com/zemartins81/encoderVideoGolang/framework/messages"
+	"github.com/zemartins81/encoderVideoGolang/framework/queue"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+// Notifier publica as notificações de resultado dos jobs.
+type Notifier interface {
+	Notify(message string, contentType string, exchange string, routingKey string) error
+}
+
+// Retrier reenvia as mensagens que falharam para uma nova tentativa ou para o dead-letter
+// exchange, registrando o erro nos cabeçalhos.
+type Retrier interface {
+	Retry(message amqp.Delivery, cause error) (bool, error)
+	DeadLetter(message amqp.Delivery, cause error) error
+}
+
+// JobManager consome as mensagens da fila, distribui-as entre CONCURRENCY_WORKERS
+// JobWorkers e trata seus resultados: jobs concluídos são confirmados e notificados, e
+// falhas são reenviadas pelo Retrier até esgotarem as tentativas, quando são notificadas.
+type JobManager struct {
+	Db               *gorm.DB
+	RabbitMQ         *queue.RabbitMQ
+	Notifier         Notifier
+	Retrier          Retrier
+	MessageChannel   chan amqp.Delivery
+	JobReturnChannel chan JobWorkerResult
+	Cancellations    *CancelRegistry
+	shutdownTimer    *time.Timer
+	mu               sync.Mutex
+}
+
+// errInvalidResult indica um resultado de job que não passa no schema das notificações.
+var errInvalidResult = errors.New("invalid job result")
+
+// ErrShutdown é a causa do cancelamento dos jobs interrompidos quando o prazo de Shutdown
+// expira. Eles terminam como FAILED e suas mensagens voltam para a fila, para que sejam
+// retomados do ponto em que pararam, no mesmo prefixo do bucket de saída.
+var ErrShutdown = errors.New("interrupted by shutdown")
+
+func NewJobManager(db *gorm.DB, rabbitMQ *queue.RabbitMQ, jobReturnChannel chan JobWorkerResult, messageChannel chan amqp.Delivery) *JobManager {
+	return &JobManager{
+		Db:               db,
+		RabbitMQ:         rabbitMQ,
+		Notifier:         rabbitMQ,
+		Retrier:          rabbitMQ,
+		MessageChannel:   messageChannel,
+		JobReturnChannel: jobReturnChannel,
+		Cancellations:    NewCancelRegistry(),
+	}
+}
+
+// Start inicia o consumo da fila e dos comandos de controle e os workers, tratando os
+// resultados até que a fila seja fechada. Se Shutdown for chamado antes, Start retorna sem
+// consumir a fila.
+func (j *JobManager) Start() error {
+	factory, err := j.newJobServiceFactory(context.Background())
+	if err != nil {
+		return err
+	}
+
+	concurrency, err := strconv.Atoi(os.Getenv("CONCURRENCY_WORKERS"))
+	if err != nil || concurrency < 1 {
+		concurrency = 1
+	}
+
+	if j.RabbitMQ.ControlExchange != "" {
+		controlChannel := make(chan amqp.Delivery)
+		err = j.RabbitMQ.ConsumeControl(controlChannel)
+		if err != nil {
+			return err
+		}
+		go ControlWorker(controlChannel, j.Cancellations, factory.JobRepository)
+	}
+
+	j.RabbitMQ.PrefetchCount = prefetchCount(j.RabbitMQ.PrefetchCount, concurrency)
+	consuming, err := j.consume()
+	if err != nil || !consuming {
+		return err
+	}
+
+	sweepDone := make(chan struct{})
+	defer close(sweepDone)
+	go sweepWorkspaces(sweepDone)
+
+	var workers sync.WaitGroup
+	for workerID := 0; workerID < concurrency; workerID++ {
+		workers.Add(1)
+		go func(workerID int) {
+			defer workers.Done()
+			JobWorker(j.MessageChannel, j.JobReturnChannel, factory, workerID)
+		}(workerID)
+	}
+	go func() {
+		workers.Wait()
+		close(j.JobReturnChannel)
+	}()
+
+	for jobResult := range j.JobReturnChannel {
+		j.handleResult(jobResult)
+	}
+
+	j.mu.Lock()
+	if j.shutdownTimer != nil {
+		j.shutdownTimer.Stop()
+	}
+	j.mu.Unlock()
+
+	return nil
+}
+
+// consume começa a consumir a fila de jobs, a menos que Shutdown já tenha sido chamado, e
+// informa se o consumo começou. A verificação e o consumo acontecem sob o mesmo lock de
+// Shutdown, para que um sinal recebido antes do consumo não seja perdido.
+func (j *JobManager) consume() (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.shutdownTimer != nil {
+		log.Println("shutdown requested before consuming the queue")
+		return false, nil
+	}
+	return true, j.RabbitMQ.Consume(j.MessageChannel)
+}
+
+// Shutdown para de consumir a fila, fazendo Start retornar quando os jobs em andamento
+// terminarem. Os jobs que não terminarem em timeout são interrompidos com ErrShutdown, e
+// suas mensagens voltam para a fila para serem retomadas depois.
+func (j *JobManager) Shutdown(timeout time.Duration) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.shutdownTimer != nil {
+		return nil
+	}
+	j.shutdownTimer = time.AfterFunc(timeout, func() {
+		count := j.Cancellations.CancelAll(ErrShutdown)
+		log.Printf("shutdown timeout expired, interrupting %d running job(s)", count)
+	})
+
+	return j.RabbitMQ.StopConsuming()
+}
+
+// prefetchCount retorna o limite de mensagens não confirmadas da instância. Sem um limite
+// configurado, ele é o número de workers, para que a instância só retenha as mensagens que
+// consegue processar e o restante da fila fique disponível para as outras instâncias.
+func prefetchCount(configured int, workers int) int {
+	if configured > 0 {
+		return configured
+	}
+	return workers
+}
+
+// newJobServiceFactory monta as dependências compartilhadas pelos workers: os
+// repositórios, os armazenamentos de entrada e saída e o KeyProvider configurados no
+// ambiente.
+func (j *JobManager) newJobServiceFactory(ctx context.Context) (*JobServiceFactory, error) {
+	inputStore, err := storage.NewInputStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	outputStore, err := storage.NewOutputStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProvider, err := drm.NewKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return &JobServiceFactory{
+		JobRepository:    &repositories.JobRepositoryDb{Db: j.Db},
+		PresetRepository: repositories.NewPresetRepositoryDb(j.Db),
+		VideoRepository:  repositories.NewVideoRepositoryDb(j.Db),
+		InputStore:       inputStore,
+		OutputStore:      outputStore,
+		KeyProvider:      keyProvider,
+		Cancellations:    j.Cancellations,
+	}, nil
+}
+
+// handleResult notifica o resultado do job e confirma a mensagem. Em caso de falha, a
+// mensagem é reenviada para uma nova tentativa e só é notificada quando vai para o
+// dead-letter exchange.
+func (j *JobManager) handleResult(jobResult JobWorkerResult) {
+	if jobResult.Error != nil {
+		log.Printf("error processing job %v: %v", jobResult.Job.ID, jobResult.Error)
+
+		if errors.Is(jobResult.Error, ErrShutdown) {
+			// A mensagem pode ser entregue a outro pod, então o workspace não é mantido aqui;
+			// a retomada refaz as etapas locais e sobrescreve os objetos já enviados.
+			cleanWorkspace(jobResult.Job)
+			err := jobResult.Message.Nack(false, true)
+			if err != nil {
+				log.Printf("error requeueing message of job %v: %v", jobResult.Job.ID, err)
+			}
+			return
+		}
+
+		if j.retry(jobResult) {
+			return
+		}
+		cleanWorkspace(jobResult.Job)
+
+		err := j.notifyError(jobResult)
+		if err != nil {
+			log.Printf("error notifying failure of job %v: %v", jobResult.Job.ID, err)
+		}
+		return
+	}
+
+	err := j.notifySuccess(jobResult)
+	if err != nil {
+		log.Printf("error notifying completion of job %v: %v", jobResult.Job.ID, err)
+	}
+	// Se a publicação falhou, a mensagem volta para a fila e a nova entrega só refaz a
+	// notificação. Um resultado inválido nunca seria publicado, então ele é descartado.
+	if err != nil && !errors.Is(err, errInvalidResult) {
+		err = jobResult.Message.Nack(false, true)
+		if err != nil {
+			log.Printf("error requeueing message of job %v: %v", jobResult.Job.ID, err)
+		}
+		return
+	}
+
+	err = jobResult.Message.Ack(false)
+	if err != nil {
+		log.Printf("error acknowledging message of job %v: %v", jobResult.Job.ID, err)
+	}
+}
+
+// retry reenvia a mensagem do job que falhou e a confirma, informando se ela será
+// processada de novo. Jobs cancelados e erros permanentes vão direto para o dead-letter
+// exchange. Sem Retrier, ou se o reenvio falhar, a mensagem é rejeitada sem recolocação
+// na fila, indo para o dead-letter exchange.
+func (j *JobManager) retry(jobResult JobWorkerResult) bool {
+	if j.Retrier != nil {
+		retried := false
+		var err error
+		if jobResult.Job.Status == domain.JobCancelled || permanentError(jobResult.Error) {
+			err = j.Retrier.DeadLetter(*jobResult.Message, jobResult.Error)
+		} else {
+			retried, err = j.Retrier.Retry(*jobResult.Message, jobResult.Error)
+		}
+
+		if err == nil {
+			err = jobResult.Message.Ack(false)
+			if err != nil {
+				log.Printf("error acknowledging message of job %v: %v", jobResult.Job.ID, err)
+			}
+			return retried
+		}
+		log.Printf("error retrying message of job %v: %v", jobResult.Job.ID, err)
+	}
+
+	err := jobResult.Message.Reject(false)
+	if err != nil {
+		log.Printf("error rejecting message of job %v: %v", jobResult.Job.ID, err)
+	}
+	return false
+}
+
+// permanentError informa se err se repetiria em qualquer nova tentativa: mensagens
+// inválidas, mídias sem suporte e opções de processamento inválidas, como um preset que
+// não existe.
+func permanentError(err error) bool {
+	var validationError *messages.ValidationError
+	var validatorErrors govalidator.Errors
+	return errors.As(err, &validationError) ||
+		errors.As(err, &validatorErrors) ||
+		errors.Is(err, messages.ErrUnsupportedVersion) ||
+		errors.Is(err, ErrUnsupportedMedia) ||
+		errors.Is(err, ErrEncryptionUnsupported) ||
+		errors.Is(err, repositories.ErrPresetNotFound)
+}
+
+// cleanWorkspace remove o workspace do job cuja mensagem não será mais processada.
+func cleanWorkspace(job domain.Job) {
+	if job.Video == nil || job.Video.ID == "" {
+		return
+	}
+
+	videoService := NewVideoService()
+	videoService.Video = job.Video
+	if err := videoService.Finish(); err != nil {
+		log.Printf("error cleaning workspace of job %v: %v", job.ID, err)
+	}
+}
+
+func (j *JobManager) notifySuccess(jobResult JobWorkerResult) error {
+	objects := make([]messages.Object, 0, len(jobResult.Objects))
+	for _, object := range jobResult.Objects {
+		objects = append(objects, messages.Object(object))
+	}
+	return j.notify(messages.NewCompletedResult(jobResult.Job, objects))
+}
+
+func (j *JobManager) notifyError(jobResult JobWorkerResult) error {
+	return j.notify(messages.NewFailedResult(
+		jobResult.Message.Body,
+		jobResult.Job,
+		jobResult.Error,
+		queue.Attempts(*jobResult.Message)+1,
+	))
+}
+
+func (j *JobManager) notify(result *messages.JobResult) error {
+	// Um resultado fora do schema quebraria os consumidores; ele é descartado com o erro
+	// nos logs em vez de publicado.
+	if err := result.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidResult, err)
+	}
+
+	jobJson, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return j.Notifier.Notify(
+		string(jobJson),
+		"application/json",
+		os.Getenv("RABBITMQ_NOTIFICATION_EX"),
+		os.Getenv("RABBITMQ_NOTIFICATION_ROUTING_KEY"),
+	)
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/messages"
+	"github.com/zemartins81/encoderVideoGolang/framework/queue"
+)
+
+// fakeAcknowledger registra as confirmações e rejeições das mensagens.
+type fakeAcknowledger struct {
+	mu       sync.Mutex
+	acked    int
+	rejected int
+	requeued bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked++
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rejected++
+	a.requeued = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// fakeNotifier guarda as notificações publicadas ou, com err, falha ao publicá-las.
+type fakeNotifier struct {
+	messages []string
+	err      error
+}
+
+func (n *fakeNotifier) Notify(message string, contentType string, exchange string, routingKey string) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func TestJobManagerAcksCompletedJobs(t *testing.T) {
+	notifier := &fakeNotifier{}
+	manager := &JobManager{Notifier: notifier}
+	ack := &fakeAcknowledger{}
+
+	job := domain.Job{ID: "job-id", Status: domain.JobCompleted}
+	manager.handleResult(JobWorkerResult{
+		Job:     job,
+		Message: &amqp.Delivery{Acknowledger: ack, Body: []byte(`{}`)},
+		Objects: []UploadedObject{{Key: "video/stream.mpd"}},
+	})
+
+	require.Equal(t, 1, ack.acked)
+	require.Equal(t, 0, ack.rejected)
+	require.Len(t, notifier.messages, 1)
+
+	var notification messages.JobResult
+	require.Nil(t, json.Unmarshal([]byte(notifier.messages[0]), &notification))
+	require.Equal(t, messages.StatusCompleted, notification.Status)
+	require.Equal(t, "job-id", notification.JobID)
+	require.Equal(t, string(domain.JobCompleted), notification.JobStatus)
+	require.Equal(t, "video/stream.mpd", notification.Objects[0].Key)
+	require.Nil(t, notification.Validate())
+}
+
+func TestJobManagerRequeuesCompletedJobsWhenNotificationFails(t *testing.T) {
+	notifier := &fakeNotifier{err: errors.New("channel closed")}
+	manager := &JobManager{Notifier: notifier}
+	ack := &fakeAcknowledger{}
+
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id", Status: domain.JobCompleted},
+		Message: &amqp.Delivery{Acknowledger: ack, Body: []byte(`{}`)},
+	})
+
+	require.Equal(t, 0, ack.acked)
+	require.Equal(t, 1, ack.rejected)
+	require.True(t, ack.requeued)
+}
+
+func TestJobManagerDoesNotPublishInvalidResults(t *testing.T) {
+	notifier := &fakeNotifier{}
+	manager := &JobManager{Notifier: notifier}
+	ack := &fakeAcknowledger{}
+
+	// Sem job_id, o resultado de um job concluído não passa no schema.
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{Status: domain.JobCompleted},
+		Message: &amqp.Delivery{Acknowledger: ack, Body: []byte(`{}`)},
+	})
+
+	require.Equal(t, 1, ack.acked)
+	require.Empty(t, notifier.messages)
+}
+
+func TestJobManagerRejectsFailedJobs(t *testing.T) {
+	notifier := &fakeNotifier{}
+	manager := &JobManager{Notifier: notifier}
+	ack := &fakeAcknowledger{}
+
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id"},
+		Message: &amqp.Delivery{Acknowledger: ack, Body: []byte(`{"resource_id": "r"}`)},
+		Error:   errors.New("file_path: non zero value required"),
+	})
+
+	require.Equal(t, 0, ack.acked)
+	require.Equal(t, 1, ack.rejected)
+	require.False(t, ack.requeued)
+
+	var notification messages.JobResult
+	require.Nil(t, json.Unmarshal([]byte(notifier.messages[0]), &notification))
+	require.Equal(t, `{"resource_id": "r"}`, notification.Message)
+	require.Equal(t, "job-id", notification.JobID)
+	require.Equal(t, messages.StatusFailed, notification.Status)
+	require.Equal(t, "file_path: non zero value required", notification.Error)
+	require.Nil(t, notification.Validate())
+}
+
+// fakeRetrier decide as novas tentativas como o RabbitMQ, com no máximo maxAttempts.
+type fakeRetrier struct {
+	maxAttempts  int
+	retried      []error
+	deadLettered []error
+}
+
+func (r *fakeRetrier) Retry(message amqp.Delivery, cause error) (bool, error) {
+	if queue.Attempts(message)+1 >= r.maxAttempts {
+		return false, r.DeadLetter(message, cause)
+	}
+	r.retried = append(r.retried, cause)
+	return true, nil
+}
+
+func (r *fakeRetrier) DeadLetter(message amqp.Delivery, cause error) error {
+	r.deadLettered = append(r.deadLettered, cause)
+	return nil
+}
+
+func TestJobManagerRetriesFailedJobs(t *testing.T) {
+	notifier := &fakeNotifier{}
+	retrier := &fakeRetrier{maxAttempts: 3}
+	manager := &JobManager{Notifier: notifier, Retrier: retrier}
+	ack := &fakeAcknowledger{}
+
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id", Status: domain.JobFailed},
+		Message: &amqp.Delivery{Acknowledger: ack, Headers: amqp.Table{queue.HeaderAttempts: int32(1)}},
+		Error:   errors.New("connection reset"),
+	})
+
+	require.Equal(t, 1, ack.acked)
+	require.Len(t, retrier.retried, 1)
+	require.Empty(t, notifier.messages)
+
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id", Status: domain.JobFailed},
+		Message: &amqp.Delivery{Acknowledger: ack, Headers: amqp.Table{queue.HeaderAttempts: int32(2)}},
+		Error:   errors.New("connection reset"),
+	})
+
+	require.Equal(t, 2, ack.acked)
+	require.Len(t, retrier.deadLettered, 1)
+	require.Len(t, notifier.messages, 1)
+
+	var notification messages.JobResult
+	require.Nil(t, json.Unmarshal([]byte(notifier.messages[0]), &notification))
+	require.Equal(t, 3, notification.Attempts)
+	require.Equal(t, "connection reset", notification.Error)
+}
+
+func TestJobManagerDoesNotRetryCancelledJobs(t *testing.T) {
+	notifier := &fakeNotifier{}
+	retrier := &fakeRetrier{maxAttempts: 3}
+	manager := &JobManager{Notifier: notifier, Retrier: retrier}
+	ack := &fakeAcknowledger{}
+
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id", Status: domain.JobCancelled},
+		Message: &amqp.Delivery{Acknowledger: ack},
+		Error:   context.Canceled,
+	})
+
+	require.Equal(t, 1, ack.acked)
+	require.Empty(t, retrier.retried)
+	require.Equal(t, []error{context.Canceled}, retrier.deadLettered)
+	require.Len(t, notifier.messages, 1)
+}
+
+func TestJobManagerPrefetchCount(t *testing.T) {
+	require.Equal(t, 4, prefetchCount(0, 4))
+	require.Equal(t, 2, prefetchCount(2, 4))
+}
+
+func TestJobManagerShutdownRequeuesInterruptedJobs(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	notifier := &fakeNotifier{}
+	retrier := &fakeRetrier{maxAttempts: 3}
+	manager := &JobManager{
+		RabbitMQ:      &queue.RabbitMQ{},
+		Notifier:      notifier,
+		Retrier:       retrier,
+		Cancellations: NewCancelRegistry(),
+	}
+
+	ctx, untrack := manager.Cancellations.Track(context.Background(), "job-id")
+	defer untrack()
+
+	require.Nil(t, manager.Shutdown(10*time.Millisecond))
+	<-ctx.Done()
+	require.ErrorIs(t, context.Cause(ctx), ErrShutdown)
+
+	video := domain.NewVideo()
+	video.ID = "video-id"
+	workspace := os.Getenv("localStoragePath") + "/video-id.mp4"
+	require.Nil(t, os.WriteFile(workspace, []byte("content"), 0644))
+
+	ack := &fakeAcknowledger{}
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id", Status: domain.JobFailed, Video: video},
+		Message: &amqp.Delivery{Acknowledger: ack},
+		Error:   fmt.Errorf("uploading interrupted: %w (context canceled)", ErrShutdown),
+	})
+
+	require.Equal(t, 0, ack.acked)
+	require.Equal(t, 1, ack.rejected)
+	require.True(t, ack.requeued)
+	require.Empty(t, retrier.deadLettered)
+	require.Empty(t, notifier.messages)
+
+	// A mensagem pode ir para outro pod, então o workspace deste é limpo.
+	_, err := os.Stat(workspace)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestJobManagerDoesNotConsumeAfterShutdown(t *testing.T) {
+	manager := &JobManager{
+		RabbitMQ:       &queue.RabbitMQ{},
+		MessageChannel: make(chan amqp.Delivery),
+		Cancellations:  NewCancelRegistry(),
+	}
+
+	// Sem conexão, o consumo falha, o que mostra que ele é tentado.
+	_, err := manager.consume()
+	require.Error(t, err)
+
+	require.Nil(t, manager.Shutdown(time.Minute))
+	consuming, err := manager.consume()
+	require.Nil(t, err)
+	require.False(t, consuming)
+}
+
+func TestJobManagerCleansWorkspaceOfDeadLetteredJobs(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	manager := &JobManager{Notifier: &fakeNotifier{}, Retrier: &fakeRetrier{maxAttempts: 1}}
+
+	video := domain.NewVideo()
+	video.ID = "video-id"
+	workspace := os.Getenv("localStoragePath") + "/video-id.mp4"
+	require.Nil(t, os.WriteFile(workspace, []byte("content"), 0644))
+
+	manager.handleResult(JobWorkerResult{
+		Job:     domain.Job{ID: "job-id", Status: domain.JobFailed, Video: video},
+		Message: &amqp.Delivery{Acknowledger: &fakeAcknowledger{}},
+		Error:   errors.New("invalid data found when processing input"),
+	})
+
+	_, err := os.Stat(workspace)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestJobManagerDeadLettersPermanentErrors(t *testing.T) {
+	for _, cause := range []error{
+		&messages.ValidationError{Errors: []messages.FieldError{{Field: "file_path", Message: "file_path is required"}}},
+		fmt.Errorf("%w: no video stream", ErrUnsupportedMedia),
+		fmt.Errorf("%w: mobile", repositories.ErrPresetNotFound),
+	} {
+		notifier := &fakeNotifier{}
+		retrier := &fakeRetrier{maxAttempts: 3}
+		manager := &JobManager{Notifier: notifier, Retrier: retrier}
+		ack := &fakeAcknowledger{}
+
+		manager.handleResult(JobWorkerResult{
+			Job:     domain.Job{ID: "job-id", Status: domain.JobFailed},
+			Message: &amqp.Delivery{Acknowledger: ack},
+			Error:   cause,
+		})
+
+		require.Equal(t, 1, ack.acked)
+		require.Empty(t, retrier.retried)
+		require.Equal(t, []error{cause}, retrier.deadLettered)
+		require.Len(t, notifier.messages, 1)
+	}
+
+	require.False(t, permanentError(errors.New("connection reset")))
+}
@@ -1,114 +1,580 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/zemartins81/encoderVideoGolang/application/repositories"
 	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/drm"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
 )
 
 type JobService struct {
-	Job           *domain.Job
-	JobRepository repositories.JobRepository
-	VideoService  VideoService
+	Job              *domain.Job
+	JobRepository    repositories.JobRepository
+	PresetRepository repositories.PresetRepository
+	VideoService     VideoService
+	OutputStore      storage.ObjectStore
+	KeyProvider      drm.KeyProvider
+	UploadReport     *UploadReport
+	Cancellations    *CancelRegistry
+	WorkerID         int
+	stageStartedAt   time.Time
 }
 
-func (j *JobService) Start() error {
+// JobServiceFactory guarda as dependências compartilhadas entre os jobs — repositórios,
+// armazenamentos, KeyProvider e registro de cancelamentos — e cria um JobService novo
+// para cada job, com seu próprio VideoService.
+type JobServiceFactory struct {
+	JobRepository    repositories.JobRepository
+	PresetRepository repositories.PresetRepository
+	VideoRepository  repositories.VideoRepository
+	InputStore       storage.ObjectStore
+	OutputStore      storage.ObjectStore
+	KeyProvider      drm.KeyProvider
+	Cancellations    *CancelRegistry
+}
 
-	err := j.changeJobStatus("DOWNLOADING")
-	if err != nil {
-		return j.failJob(err)
+// NewJobService cria um JobService sem job, pronto para processar uma única mensagem.
+func (f *JobServiceFactory) NewJobService(workerID int) *JobService {
+	videoService := NewVideoService()
+	videoService.VideoRepository = f.VideoRepository
+	videoService.Store = f.InputStore
+
+	return &JobService{
+		JobRepository:    f.JobRepository,
+		PresetRepository: f.PresetRepository,
+		VideoService:     videoService,
+		OutputStore:      f.OutputStore,
+		KeyProvider:      f.KeyProvider,
+		Cancellations:    f.Cancellations,
+		WorkerID:         workerID,
 	}
+}
 
-	err := j.VideoService.Download(os.Getenv("INPUTBUCKETNAME"))
-	if err != nil {
-		return j.failJob(err)
+// stage é uma etapa do processamento. Etapas com checkpoint concluídas em uma execução
+// anterior do job são puladas enquanto valid confirmar que seus artefatos continuam no
+// workspace.
+type stage struct {
+	status     domain.JobStatus
+	checkpoint string
+	run        func(ctx context.Context) error
+	valid      func(ctx context.Context) bool
+}
+
+// Start processa o job etapa por etapa. Ao retomar um job interrompido, as etapas iniciais
+// já concluídas e com artefatos válidos são puladas; a partir da primeira etapa executada,
+// todas as seguintes são refeitas. Se o upload já foi concluído, resta apenas a limpeza.
+//
+// Cada etapa roda com o tempo limite configurado em stageTimeout. Se ctx for cancelado
+// ou uma etapa estourar o tempo limite, o job termina como CANCELLED ou TIMED_OUT, a menos
+// que a causa do cancelamento seja ErrShutdown. Com
+// Cancellations, o job pode ser cancelado pelo seu ID enquanto estiver em andamento.
+func (j *JobService) Start(ctx context.Context) error {
+	if j.Cancellations != nil {
+		var untrack func()
+		ctx, untrack = j.Cancellations.Track(ctx, j.Job.ID)
+		defer untrack()
 	}
+	j.stageStartedAt = time.Now()
 
-	err = j.changeJobStatus("FRAGMENTING")
+	stages, err := j.stages()
 	if err != nil {
 		return j.failJob(err)
 	}
 
-	err = j.VideoService.Fragment()
-	if err != nil {
-		return j.failJob(err)
+	uploaded := j.Job.StageCompleted(domain.StageUploaded)
+	skipping := true
+	completed := domain.StringList{}
+
+	for _, stage := range stages {
+		if ctx.Err() != nil {
+			return j.failJob(context.Cause(ctx))
+		}
+
+		err = j.changeJobStatus(stage.status)
+		if err != nil {
+			return j.failJob(err)
+		}
+
+		skipping = skipping && stage.checkpoint != "" && j.Job.StageCompleted(stage.checkpoint) && (uploaded || stage.valid(ctx))
+		if skipping {
+			log.Printf("job %v: %s already completed, skipping", j.Job.ID, stage.checkpoint)
+			completed = append(completed, stage.checkpoint)
+			continue
+		}
+
+		j.Job.CompletedStages = append(domain.StringList{}, completed...)
+		err = j.runStage(ctx, stage)
+		if err != nil {
+			return j.failJob(err)
+		}
+
+		if stage.checkpoint != "" {
+			completed = append(completed, stage.checkpoint)
+			err = j.checkpoint(stage.checkpoint)
+			if err != nil {
+				return j.failJob(err)
+			}
+		}
 	}
 
-	err = j.changeJobStatus("ENCODING")
+	err = j.changeJobStatus(domain.JobCompleted)
 	if err != nil {
 		return j.failJob(err)
 	}
 
-	err = j.VideoService.Encode()
+	return nil
+}
+
+// runStage executa a etapa com o tempo limite configurado. Se a etapa falhar porque o
+// contexto foi cancelado ou expirou, o erro retornado encapsula a causa do cancelamento.
+func (j *JobService) runStage(ctx context.Context, stage stage) error {
+	if timeout := stageTimeout(stage.status); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := stage.run(ctx)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, context.Cause(ctx)) {
+		return fmt.Errorf("%s interrupted: %w (%v)", strings.ToLower(string(stage.status)), context.Cause(ctx), err)
+	}
+	return err
+}
+
+// stageTimeout retorna o tempo limite da etapa, lido de TIMEOUT_<STATUS> (por exemplo,
+// TIMEOUT_TRANSCODING=2h) ou, se ausente, de STAGE_TIMEOUT. Zero desativa o limite.
+func stageTimeout(status domain.JobStatus) time.Duration {
+	value := os.Getenv("TIMEOUT_" + string(status))
+	if value == "" {
+		value = os.Getenv("STAGE_TIMEOUT")
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// stages monta as etapas do job na ordem de execução. A geração de sprites só é incluída
+// quando habilitada.
+func (j *JobService) stages() ([]stage, error) {
+	video := &j.VideoService
+	inputBucket := os.Getenv("INPUTBUCKETNAME")
+
+	stages := []stage{
+		{
+			status:     domain.JobDownloading,
+			checkpoint: domain.StageDownloaded,
+			run: func(ctx context.Context) error {
+				err := video.Download(ctx, inputBucket)
+				if err != nil {
+					return err
+				}
+				return video.DownloadCaptions(ctx, inputBucket, j.captionFormat())
+			},
+			valid: func(ctx context.Context) bool { return video.VerifyDownload(ctx, inputBucket) == nil },
+		},
+		{
+			status:     domain.JobProbing,
+			checkpoint: domain.StageProbed,
+			run:        video.Probe,
+			valid:      func(ctx context.Context) bool { return video.Video.Duration > 0 },
+		},
+		{
+			status:     domain.JobTranscoding,
+			checkpoint: domain.StageTranscoded,
+			run:        func(ctx context.Context) error { return video.Transcode(ctx, j.Job) },
+			valid:      func(ctx context.Context) bool { return video.Transcoded(j.Job) },
+		},
+		{
+			status:     domain.JobFragmenting,
+			checkpoint: domain.StageFragmented,
+			run:        func(ctx context.Context) error { return video.Fragment(ctx, j.Job) },
+			valid:      func(ctx context.Context) bool { return video.Fragmented(j.Job) },
+		},
+		{
+			status:     domain.JobEncoding,
+			checkpoint: domain.StageEncoded,
+			run: func(ctx context.Context) error {
+				err := j.contentKey(ctx)
+				if err != nil {
+					return err
+				}
+				return video.Encode(ctx, j.Job)
+			},
+			valid: func(ctx context.Context) bool { return video.Encoded(j.Job) },
+		},
+	}
+
+	opts, enabled, err := spriteOptions()
 	if err != nil {
-		j.failJob(err)
+		return nil, err
+	}
+	if enabled {
+		stages = append(stages, stage{
+			status:     domain.JobGeneratingSprites,
+			checkpoint: domain.StageSprites,
+			run:        func(ctx context.Context) error { return video.Sprites(ctx, j.Job, opts) },
+			valid:      func(ctx context.Context) bool { return workspaceFileExists(j.Job.SpriteTrack) },
+		})
 	}
 
-	err = j.performUplod()
+	stages = append(stages,
+		stage{
+			status:     domain.JobThumbnailing,
+			checkpoint: domain.StageThumbnails,
+			run:        j.thumbnails,
+			valid:      func(ctx context.Context) bool { return workspaceFileExists(j.Job.Poster) },
+		},
+		stage{
+			status:     domain.JobUploading,
+			checkpoint: domain.StageUploaded,
+			run:        j.performUplod,
+			valid:      func(ctx context.Context) bool { return true },
+		},
+		stage{
+			status: domain.JobFinishing,
+			run:    j.finish,
+		},
+	)
+
+	return stages, nil
+}
+
+// checkpoint registra no job a conclusão da etapa.
+func (j *JobService) checkpoint(stage string) error {
+	j.Job.CompleteStage(stage)
+	_, err := j.JobRepository.Update(j.Job)
+	return err
+}
+
+// ApplyPreset carrega o preset indicado em Job.PresetName ou, se não informado, o preset
+// DEFAULT_PRESET. Sem nenhum dos dois, usa um preset padrão com a escada ENCODING_LADDER,
+// segmentos de KEYFRAME_INTERVAL segundos, o empacotamento DEFAULT_PACKAGING e a criptografia
+// DEFAULT_ENCRYPTION. Se o job não definir o empacotamento, usa o do preset. Presets com
+// criptografia exigem empacotamento DASH e um KeyProvider.
+func (j *JobService) ApplyPreset() error {
+	var err error
+
+	name := j.Job.PresetName
+	if name == "" {
+		name = os.Getenv("DEFAULT_PRESET")
+	}
+
+	if name != "" {
+		j.Job.Preset, err = j.PresetRepository.FindByName(name)
+		// Um job retomado que usou o preset padrão já traz o nome "default".
+		if err != nil && name == defaultPresetName {
+			j.Job.Preset, err = defaultPreset()
+		}
+	} else {
+		j.Job.Preset, err = defaultPreset()
+	}
 	if err != nil {
-		return j.failJob(err)
+		return err
+	}
+
+	j.Job.PresetName = j.Job.Preset.Name
+	if j.Job.Packaging == "" {
+		j.Job.Packaging = j.Job.Preset.Packaging
+	}
+
+	if j.encrypted() {
+		if j.Job.Packaging == domain.PackagingHLS {
+			return ErrEncryptionUnsupported
+		}
+		if j.KeyProvider == nil {
+			return fmt.Errorf("preset %s requires encryption but no key provider is configured", j.Job.PresetName)
+		}
+	}
+
+	return nil
+}
+
+func (j *JobService) encrypted() bool {
+	return j.Job.Preset != nil && j.Job.Preset.Encryption != domain.EncryptionNone
+}
+
+// contentKey obtém do KeyProvider a chave do job quando o preset pede criptografia,
+// registrando o KID no job para o servidor de licenças.
+func (j *JobService) contentKey(ctx context.Context) error {
+	j.VideoService.ContentKey = nil
+	if !j.encrypted() {
+		return nil
+	}
+	if j.KeyProvider == nil {
+		return fmt.Errorf("preset %s requires encryption but no key provider is configured", j.Job.PresetName)
 	}
 
-	err = j.changeJobStatus("FINISHING")
+	key, err := j.KeyProvider.Key(ctx, j.Job.ID)
 	if err != nil {
-		return j.failJob(err)
+		return err
 	}
-	err = j.VideoService.Finish()
+	if err = key.Validate(); err != nil {
+		return err
+	}
+
+	j.VideoService.ContentKey = key
+	j.Job.KID = key.KID
+	_, err = j.JobRepository.Update(j.Job)
+	return err
+}
+
+// defaultPresetName é o nome do preset montado por defaultPreset.
+const defaultPresetName = "default"
+
+func defaultPreset() (*domain.Preset, error) {
+	renditions, err := domain.ParseRenditions(os.Getenv("ENCODING_LADDER"))
 	if err != nil {
-		return j.failJob(err)
+		return nil, err
+	}
+	if len(renditions) == 0 {
+		renditions = domain.DefaultRenditions()
 	}
 
-	err = j.changeJobStatus("COMPLETED")
+	preset, err := domain.NewPreset(defaultPresetName, renditions)
 	if err != nil {
-		return j.failJob(err)
+		return nil, err
 	}
 
-	return nil
+	if segmentDuration, err := strconv.Atoi(os.Getenv("KEYFRAME_INTERVAL")); err == nil && segmentDuration > 0 {
+		preset.SegmentDuration = segmentDuration
+	}
+	if packaging := os.Getenv("DEFAULT_PACKAGING"); packaging != "" {
+		preset.Packaging = packaging
+	}
+	if encryption := os.Getenv("DEFAULT_ENCRYPTION"); encryption != "" {
+		preset.Encryption = encryption
+	}
+
+	return preset, preset.Validate()
+}
+
+// captionFormat retorna o formato das legendas empacotadas: CAPTION_FORMAT (webvtt ou
+// ttml) para DASH. Playlists HLS só aceitam WebVTT.
+func (j *JobService) captionFormat() string {
+	format := os.Getenv("CAPTION_FORMAT")
+	if format != domain.CaptionFormatTTML || j.Job.Packaging != domain.PackagingDASH {
+		return domain.CaptionFormatWebVTT
+	}
+	return format
+}
+
+// spriteOptions lê a configuração das sprite sheets de pré-visualização, habilitadas
+// quando SPRITE_INTERVAL for maior que zero, com quadros de SPRITE_SIZE (160x90 por
+// padrão) em grades de SPRITE_COLUMNS x SPRITE_ROWS (10x10 por padrão).
+func spriteOptions() (SpriteOptions, bool, error) {
+	interval, err := strconv.ParseFloat(os.Getenv("SPRITE_INTERVAL"), 64)
+	if err != nil || interval <= 0 {
+		return SpriteOptions{}, false, nil
+	}
+
+	opts := SpriteOptions{Interval: interval, Width: 160, Height: 90, Columns: 10, Rows: 10}
+
+	if size := os.Getenv("SPRITE_SIZE"); size != "" {
+		sizes, err := ParseThumbnailSizes(size)
+		if err != nil {
+			return opts, false, err
+		}
+		opts.Width = sizes[0].Width
+		opts.Height = sizes[0].Height
+	}
+	if columns, err := strconv.Atoi(os.Getenv("SPRITE_COLUMNS")); err == nil && columns > 0 {
+		opts.Columns = columns
+	}
+	if rows, err := strconv.Atoi(os.Getenv("SPRITE_ROWS")); err == nil && rows > 0 {
+		opts.Rows = rows
+	}
+
+	return opts, true, nil
 }
 
-func (j *JobService) performUplod() error {
+// thumbnails gera o poster e THUMBNAIL_COUNT thumbnails (5 por padrão) em cada resolução
+// de THUMBNAIL_SIZES.
+func (j *JobService) thumbnails(ctx context.Context) error {
+	count, err := strconv.Atoi(os.Getenv("THUMBNAIL_COUNT"))
+	if err != nil || count < 0 {
+		count = 5
+	}
 
-	err := j.changeJobStatus("UPLOADING")
+	sizes, err := ParseThumbnailSizes(os.Getenv("THUMBNAIL_SIZES"))
 	if err != nil {
-		return j.failJob(err)
+		return err
 	}
 
-	videouUpload := NewVideoUpload()
-	videouUpload.OutputBucket = os.Getenv("OUTPUTBUCKETNAME")
-	videouUpload.VideoPath = os.Getenv("LOCALSTORAGEPATH") + "/" + j.VideoService.Video.ID
-	concurrency, _ := strconv.Atoi(os.Getenv("CONCURRENCY_UPLOAD"))
+	return j.VideoService.Thumbnails(ctx, j.Job, count, sizes)
+}
+
+func (j *JobService) performUplod(ctx context.Context) error {
+	videouUpload := j.newVideoUpload()
+	concurrency, err := strconv.Atoi(os.Getenv("CONCURRENCY_UPLOAD"))
+	if err != nil || concurrency < 1 {
+		concurrency = 1
+	}
 	doneUpload := make(chan string)
 
-	go videouUpload.ProcessUpload(concurrency, doneUpload)
+	go videouUpload.ProcessUpload(concurrency, doneUpload, ctx)
 
 	var uploadResult string
 	uploadResult = <-doneUpload
+	j.UploadReport = videouUpload.Report
 	if uploadResult != "upload completed" {
-		return j.failJob(errors.New(uploadResult))
+		return errors.New(uploadResult)
 	}
 	return nil
 }
 
-func (j *JobService) changeJobStatus(status string) error {
-	var err error
+// restoreUploadReport refaz, a partir dos objetos do vídeo no bucket de saída, o relatório
+// de upload de um job retomado depois do upload, para que a notificação de conclusão traga
+// os objetos e suas URLs assinadas.
+func (j *JobService) restoreUploadReport(ctx context.Context) error {
+	videoUpload := j.newVideoUpload()
+	err := videoUpload.Restore(ctx, j.VideoService.Video.ID+"/")
+	if err != nil {
+		return err
+	}
+	j.UploadReport = videoUpload.Report
+	return nil
+}
+
+// finish remove o workspace do vídeo, restaurando antes o relatório de upload se o upload
+// foi pulado.
+func (j *JobService) finish(ctx context.Context) error {
+	if j.UploadReport == nil {
+		err := j.restoreUploadReport(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return j.VideoService.Finish()
+}
 
-	j.Job.Status = status
-	j.Job, err = j.JobRepository.Update(j.Job)
+func (j *JobService) newVideoUpload() *VideoUpload {
+	videouUpload := NewVideoUpload()
+	videouUpload.OutputBucket = os.Getenv("OUTPUTBUCKETNAME")
+	videouUpload.Store = j.OutputStore
+	videouUpload.ACL = storage.ACL(j.Job.AccessPolicy)
+	if expiration, err := time.ParseDuration(os.Getenv("SIGNED_URL_EXPIRATION")); err == nil {
+		videouUpload.URLExpiration = expiration
+	}
+	videouUpload.VideoPath = os.Getenv("localStoragePath") + "/" + j.VideoService.Video.ID
+	if maxRetries, err := strconv.Atoi(os.Getenv("UPLOAD_MAX_RETRIES")); err == nil {
+		videouUpload.MaxRetries = maxRetries
+	}
+	return videouUpload
+}
 
+// changeJobStatus move o job para status, recusando transições ilegais.
+func (j *JobService) changeJobStatus(status domain.JobStatus) error {
+	previous := j.Job.Status
+
+	err := j.Job.TransitionTo(status)
 	if err != nil {
 		return j.failJob(err)
 	}
 
+	_, err = j.JobRepository.Update(j.Job)
+	if err != nil {
+		j.Job.Status = previous
+		return j.failJob(err)
+	}
+
+	j.recordEvent(previous)
 	return nil
 }
+
+// failJob marca o job como TIMED_OUT ou CANCELLED, se o erro vier de um contexto expirado
+// ou cancelado, ou como FAILED nos demais casos, com a mensagem do erro, e retorna o erro
+// original. Jobs interrompidos por ErrShutdown ficam como FAILED, para serem retomados. O
+// workspace de jobs cancelados é removido, assim como o dos que falharam quando
+// RESUME_FAILED_JOBS desativa a retomada; nesses casos, os objetos já enviados ao bucket
+// de saída também são removidos, pois o job não volta a usar o mesmo prefixo. Jobs já
+// concluídos ou interrompidos não são alterados.
 func (j *JobService) failJob(error error) error {
-	j.Job.Status = "FAILED"
+	previous := j.Job.Status
+	if previous.Interrupted() {
+		return error
+	}
+
+	status := domain.JobFailed
+	switch {
+	case errors.Is(error, ErrShutdown):
+	case errors.Is(error, context.DeadlineExceeded):
+		status = domain.JobTimedOut
+	case errors.Is(error, context.Canceled):
+		status = domain.JobCancelled
+	}
+
+	if j.Job.TransitionTo(status) != nil {
+		return error
+	}
 	j.Job.Error = error.Error()
 	_, err := j.JobRepository.Update(j.Job)
 	if err != nil {
 		return err
 	}
+
+	j.recordEvent(previous)
+
+	if (status == domain.JobCancelled || !resumeEnabled()) && j.VideoService.Video != nil {
+		if previous == domain.JobUploading || previous == domain.JobFinishing {
+			j.deleteOutput()
+		}
+		if err = j.VideoService.Finish(); err != nil {
+			log.Printf("error cleaning workspace of job %v: %v", j.Job.ID, err)
+		}
+	}
+	return error
+}
+
+// deleteOutput remove do bucket de saída os objetos do vídeo enviados por um job que não
+// será retomado.
+func (j *JobService) deleteOutput() {
+	if j.OutputStore == nil {
+		return
+	}
+
+	ctx := context.Background()
+	bucket := os.Getenv("OUTPUTBUCKETNAME")
+	objects, err := j.OutputStore.List(ctx, bucket, j.VideoService.Video.ID+"/")
+	if err != nil {
+		log.Printf("error listing output of job %v: %v", j.Job.ID, err)
+		return
+	}
+
+	for _, object := range objects {
+		err = j.OutputStore.Delete(ctx, bucket, object.Key)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			log.Printf("error deleting %s of job %v: %v", object.Key, j.Job.ID, err)
+		}
+	}
+}
+
+// recordEvent registra no histórico do job a mudança do status previous para o atual,
+// com o tempo gasto em previous. Falhas ao gravar o evento não interrompem o job.
+func (j *JobService) recordEvent(previous domain.JobStatus) {
+	now := time.Now()
+	if j.stageStartedAt.IsZero() {
+		j.stageStartedAt = j.Job.CreatedAt
+	}
+	duration := now.Sub(j.stageStartedAt)
+	j.stageStartedAt = now
+
+	event, err := domain.NewJobEvent(j.Job, previous, duration, j.WorkerID)
+	if err == nil {
+		err = j.JobRepository.AddEvent(event)
+	}
+	if err != nil {
+		log.Printf("error recording %s event for job %v: %v", j.Job.Status, j.Job.ID, err)
+	}
 }
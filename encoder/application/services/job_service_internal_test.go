@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/database"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+func TestFailJobDeletesOutputWhenResumeIsDisabled(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("RESUME_FAILED_JOBS", "false")
+
+	db := database.NewDbTest()
+	t.Cleanup(func() { db.Close() })
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.ResourceID = "resource"
+	video.FilePath = "emilly.mp4"
+	video.CreatedAt = time.Now()
+
+	job, err := domain.NewJob("encodervideotest", domain.JobUploading, video)
+	require.Nil(t, err)
+	jobRepository := &repositories.JobRepositoryDb{Db: db}
+	_, err = jobRepository.Insert(job)
+	require.Nil(t, err)
+
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+	for _, key := range []string{video.ID + "/stream.mpd", "other/stream.mpd"} {
+		require.Nil(t, store.Put(ctx, "encodervideotest", key, strings.NewReader("mpd"), storage.PutOptions{}))
+	}
+
+	jobService := &JobService{Job: job, JobRepository: jobRepository, OutputStore: store}
+	jobService.VideoService.Video = video
+
+	err = jobService.failJob(errors.New("connection reset"))
+	require.Error(t, err)
+	require.Equal(t, domain.JobFailed, job.Status)
+
+	objects, err := store.List(ctx, "encodervideotest", "")
+	require.Nil(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, "other/stream.mpd", objects[0].Key)
+}
@@ -0,0 +1,253 @@
+package services_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/database"
+	"github.com/zemartins81/encoderVideoGolang/framework/drm"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+func prepareJobService(t *testing.T) *services.JobService {
+	db := database.NewDbTest()
+	t.Cleanup(func() { db.Close() })
+
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.ResourceID = "resource"
+	video.FilePath = "emilly.mp4"
+	video.CreatedAt = time.Now()
+
+	job, err := domain.NewJob("encodervideotest", domain.JobStarting, video)
+	require.Nil(t, err)
+	job.Packaging = ""
+
+	return &services.JobService{
+		Job:              job,
+		JobRepository:    &repositories.JobRepositoryDb{Db: db},
+		PresetRepository: repositories.NewPresetRepositoryDb(db),
+	}
+}
+
+func TestJobServiceApplyPreset(t *testing.T) {
+	jobService := prepareJobService(t)
+
+	preset, err := domain.NewPreset("web-hd", domain.DefaultRenditions())
+	require.Nil(t, err)
+	preset.Packaging = domain.PackagingHLS
+	_, err = jobService.PresetRepository.Insert(preset)
+	require.Nil(t, err)
+
+	jobService.Job.PresetName = "web-hd"
+	err = jobService.ApplyPreset()
+	require.Nil(t, err)
+	require.Equal(t, preset.ID, jobService.Job.Preset.ID)
+	require.Equal(t, domain.PackagingHLS, jobService.Job.Packaging)
+}
+
+func TestJobServiceApplyPresetKeepsJobPackaging(t *testing.T) {
+	jobService := prepareJobService(t)
+
+	preset, err := domain.NewPreset("web-hd", domain.DefaultRenditions())
+	require.Nil(t, err)
+	_, err = jobService.PresetRepository.Insert(preset)
+	require.Nil(t, err)
+
+	jobService.Job.PresetName = "web-hd"
+	jobService.Job.Packaging = domain.PackagingDASHHLS
+	err = jobService.ApplyPreset()
+	require.Nil(t, err)
+	require.Equal(t, domain.PackagingDASHHLS, jobService.Job.Packaging)
+}
+
+func TestJobServiceApplyUnknownPreset(t *testing.T) {
+	jobService := prepareJobService(t)
+
+	jobService.Job.PresetName = "mobile"
+	err := jobService.ApplyPreset()
+	require.Error(t, err)
+}
+
+func TestJobServiceApplyDefaultPreset(t *testing.T) {
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("ENCODING_LADDER", "720p:1280x720:2800:128")
+	t.Setenv("KEYFRAME_INTERVAL", "4")
+	t.Setenv("DEFAULT_PACKAGING", "")
+	jobService := prepareJobService(t)
+
+	err := jobService.ApplyPreset()
+	require.Nil(t, err)
+	require.Equal(t, "default", jobService.Job.PresetName)
+	require.Len(t, jobService.Job.Preset.Renditions, 1)
+	require.Equal(t, 4, jobService.Job.Preset.SegmentDuration)
+	require.Equal(t, domain.PackagingDASH, jobService.Job.Packaging)
+}
+
+func TestJobServiceApplyEncryptedPreset(t *testing.T) {
+	jobService := prepareJobService(t)
+
+	preset, err := domain.NewPreset("protected", domain.DefaultRenditions())
+	require.Nil(t, err)
+	preset.Encryption = domain.EncryptionCBCS
+	_, err = jobService.PresetRepository.Insert(preset)
+	require.Nil(t, err)
+	jobService.Job.PresetName = "protected"
+
+	err = jobService.ApplyPreset()
+	require.Error(t, err)
+
+	jobService.KeyProvider = drm.NewFileKeyProvider(filepath.Join(t.TempDir(), "keys.json"))
+	err = jobService.ApplyPreset()
+	require.Nil(t, err)
+
+	jobService.Job.Packaging = domain.PackagingHLS
+	err = jobService.ApplyPreset()
+	require.ErrorIs(t, err, services.ErrEncryptionUnsupported)
+}
+
+func TestVideoServiceEncodeRequiresContentKey(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	jobService := prepareJobService(t)
+
+	preset, err := domain.NewPreset("protected", domain.DefaultRenditions())
+	require.Nil(t, err)
+	preset.Encryption = domain.EncryptionCENC
+	jobService.Job.Preset = preset
+	jobService.Job.Packaging = domain.PackagingDASH
+
+	videoService := services.NewVideoService()
+	videoService.Video = jobService.Job.Video
+	err = videoService.Encode(context.Background(), jobService.Job)
+	require.ErrorContains(t, err, "no content key")
+
+	jobService.Job.Packaging = domain.PackagingHLS
+	err = videoService.Encode(context.Background(), jobService.Job)
+	require.ErrorIs(t, err, services.ErrEncryptionUnsupported)
+}
+
+func TestJobServiceRecordsTimeline(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	jobService := prepareJobService(t)
+	jobService.WorkerID = 7
+	_, err := jobService.JobRepository.Insert(jobService.Job)
+	require.Nil(t, err)
+
+	jobService.VideoService.Video = jobService.Job.Video
+	jobService.VideoService.Store = storage.NewLocalStore(t.TempDir())
+
+	err = jobService.Start(context.Background())
+	require.ErrorIs(t, err, storage.ErrObjectNotFound)
+
+	events, err := jobService.JobRepository.Timeline(jobService.Job.ID)
+	require.Nil(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, domain.JobDownloading, events[0].Status)
+	require.Equal(t, domain.JobDownloading, events[1].FromStatus)
+	require.Equal(t, domain.JobFailed, events[1].Status)
+	require.Equal(t, jobService.Job.Error, events[1].Error)
+	require.Equal(t, 7, events[1].WorkerID)
+	require.GreaterOrEqual(t, events[1].Duration, time.Duration(0))
+}
+
+// blockingStore segura as leituras até que o contexto seja encerrado.
+type blockingStore struct {
+	storage.ObjectStore
+}
+
+func (s blockingStore) Get(ctx context.Context, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestJobServiceCancelled(t *testing.T) {
+	jobService := prepareResume(t, "video content")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := jobService.Start(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, domain.JobCancelled, jobService.Job.Status)
+	require.Equal(t, []domain.JobStatus{domain.JobCancelled}, timelineStatuses(t, jobService))
+}
+
+func TestJobServiceStageTimeout(t *testing.T) {
+	jobService := prepareResume(t, "video content")
+	jobService.VideoService.Store = blockingStore{jobService.VideoService.Store}
+	t.Setenv("STAGE_TIMEOUT", "")
+	t.Setenv("TIMEOUT_DOWNLOADING", "20ms")
+
+	err := jobService.Start(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, domain.JobTimedOut, jobService.Job.Status)
+	require.Equal(t, []domain.JobStatus{domain.JobDownloading, domain.JobTimedOut}, timelineStatuses(t, jobService))
+
+	job, err := jobService.JobRepository.Find(jobService.Job.ID)
+	require.Nil(t, err)
+	require.Equal(t, domain.JobTimedOut, job.Status)
+}
+
+func TestJobServiceCancelledByID(t *testing.T) {
+	jobService := prepareResume(t, "video content")
+	jobService.VideoService.Store = blockingStore{jobService.VideoService.Store}
+	jobService.Cancellations = services.NewCancelRegistry()
+
+	go func() {
+		for len(jobService.Cancellations.Running()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		jobService.Cancellations.Cancel(jobService.Job.ID)
+	}()
+
+	err := jobService.Start(context.Background())
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, domain.JobCancelled, jobService.Job.Status)
+	require.Empty(t, jobService.Cancellations.Running())
+
+	_, err = os.Stat(os.Getenv("localStoragePath") + "/" + jobService.Job.Video.ID + ".mp4")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestJobServiceCleansWorkspaceWhenResumeIsDisabled(t *testing.T) {
+	t.Setenv("RESUME_FAILED_JOBS", "false")
+	jobService := prepareResume(t, "video content")
+	jobService.VideoService.Store = storage.NewLocalStore(t.TempDir())
+
+	err := jobService.Start(context.Background())
+	require.Error(t, err)
+	require.Equal(t, domain.JobFailed, jobService.Job.Status)
+
+	_, err = os.Stat(os.Getenv("localStoragePath") + "/" + jobService.Job.Video.ID + ".mp4")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestJobServiceInterruptedByShutdownCanBeResumed(t *testing.T) {
+	jobService := prepareResume(t, "video content")
+	jobService.VideoService.Store = blockingStore{jobService.VideoService.Store}
+	jobService.Cancellations = services.NewCancelRegistry()
+
+	go func() {
+		for jobService.Cancellations.CancelAll(services.ErrShutdown) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	err := jobService.Start(context.Background())
+	require.ErrorIs(t, err, services.ErrShutdown)
+	require.NotErrorIs(t, err, context.Canceled)
+	require.Equal(t, domain.JobFailed, jobService.Job.Status)
+
+	// Quem limpa o workspace é o JobManager, ao devolver a mensagem para a fila.
+	_, err = os.Stat(os.Getenv("localStoragePath") + "/" + jobService.Job.Video.ID + ".mp4")
+	require.Nil(t, err)
+}
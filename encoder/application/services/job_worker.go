@@ -1,72 +1,223 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
 	"github.com/streadway/amqp"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
 	"github.com/zemartins81/encoderVideoGolang/domain"
-	"github.com/zemartins81/encoderVideoGolang/framework/utils"
+	"github.com/zemartins81/encoderVideoGolang/framework/messages"
+	"github.com/zemartins81/encoderVideoGolang/framework/queue"
+)
+
+var (
+	// ErrJobCancelled indica a nova tentativa de um job que foi cancelado enquanto aguardava.
+	ErrJobCancelled = errors.New("job was cancelled")
+	// errJobCompleted indica a nova entrega de um job concluído cuja notificação falhou.
+	errJobCompleted = errors.New("job was already completed")
+	// errNotResumable indica que o pedido não tem um job a retomar e deve criar um novo.
+	errNotResumable = errors.New("no job to resume")
 )
 
 type JobWorkerResult struct {
 	Job     domain.Job
 	Message *amqp.Delivery
 	Error   error
+	Objects []UploadedObject
 }
 
-func JobWorker(messageChannel chan amqp.Delivery, returnChan chan JobWorkerResult, jobService JobService, job domain.Job, workerID int) {
-
+// JobWorker processa as mensagens de messageChannel, uma por vez, enviando o resultado
+// de cada uma em returnChan. Cada mensagem é processada por um JobService novo, criado
+// por factory, para que o estado de um job nunca vaze para outro.
+func JobWorker(messageChannel chan amqp.Delivery, returnChan chan JobWorkerResult, factory *JobServiceFactory, workerID int) {
 	for message := range messageChannel {
-		err := utils.IsJson(string(message.Body))
+		returnChan <- processMessage(message, factory.NewJobService(workerID))
+	}
+}
 
-		if err != nil {
-			returnChan <- returnJobResult(domain.Job{}, message, err)
-			continue
-		}
+func processMessage(message amqp.Delivery, jobService *JobService) JobWorkerResult {
+	request, err := messages.ParseJobRequest(message.Body)
+	if err != nil {
+		return returnJobResult(domain.Job{}, message, err)
+	}
+
+	video := request.Video()
+	video.ID = uuid.NewV4().String()
 
-		err = json.Unmarshal(message.Body, &jobService.VideoService.Video)
-		jobService.VideoService.Video.ID = uuid.NewV4().String()
+	err = video.Validate()
+	if err != nil {
+		return returnJobResult(domain.Job{}, message, err)
+	}
 
+	job, err := resumableJob(jobService.JobRepository, request, message)
+	switch {
+	case err == nil:
+		err = resumeJob(jobService, job)
 		if err != nil {
-			returnChan <- returnJobResult(domain.Job{}, message, err)
-			continue
+			return returnJobResult(*job, message, err)
 		}
-
-		err = jobService.VideoService.Video.Validate()
+	case errors.Is(err, ErrJobCancelled):
+		return returnJobResult(*job, message, err)
+	case errors.Is(err, errJobCompleted):
+		// Só a notificação de conclusão falhou; ela é refeita sem processar o vídeo de novo.
+		jobService.VideoService.Video = job.Video
+		jobService.Job = job
+		err = jobService.restoreUploadReport(context.Background())
 		if err != nil {
-			returnChan <- returnJobResult(domain.Job{}, message, err)
-			continue
+			return returnJobResult(*job, message, err)
 		}
-
-		err = jobService.VideoService.InsertVideo()
+		return completedJobResult(jobService, message)
+	case gorm.IsRecordNotFoundError(err) || errors.Is(err, errNotResumable):
+		job = &domain.Job{}
+		err = newJob(jobService, job, video, request)
 		if err != nil {
-			returnChan <- returnJobResult(domain.Job{}, message, err)
-			continue
+			return returnJobResult(domain.Job{}, message, err)
 		}
+	default:
+		// Uma falha do banco não pode virar um job novo, que abandonaria o workspace e o
+		// prefixo de saída do job que poderia ser retomado; a mensagem é repetida.
+		return returnJobResult(domain.Job{}, message, err)
+	}
 
-		job.Video = jobService.VideoService.Video
-		job.OutputBucketPath = os.Getenv("OUTPUTBUCKETNAME")
-		job.ID = uuid.NewV4().String()
-		job.Status = "STARTING"
-		job.CreatedAt = time.Now()
+	err = jobService.Start(context.Background())
+	if err != nil {
+		return returnJobResult(*job, message, err)
+	}
 
-		_, err = jobService.JobRepository.Insert(&job)
-		if err != nil {
-			returnChan <- returnJobResult(domain.Job{}, message, err)
-			continue
-		}
+	return completedJobResult(jobService, message)
+}
 
-		jobService.Job = &job
-		err = JobService.Start()
-		if err != nil {
-			returnChan <- returnJobResult(domain.Job{}, message, err)
-			continue
-		}
-		returnChan <- returnJobResult(job, message, nil)
+// completedJobResult retorna o resultado do job concluído por jobService, com os objetos
+// enviados para o bucket de saída.
+func completedJobResult(jobService *JobService, message amqp.Delivery) JobWorkerResult {
+	result := returnJobResult(*jobService.Job, message, nil)
+	if jobService.UploadReport != nil {
+		result.Objects = jobService.UploadReport.Objects()
+	}
+	return result
+}
+
+// newJob grava o vídeo do pedido e cria para ele um novo job, registrando no histórico o
+// status inicial.
+func newJob(jobService *JobService, job *domain.Job, video *domain.Video, request *messages.JobRequest) error {
+	jobService.VideoService.Video = video
+	err := jobService.VideoService.InsertVideo()
+	if err != nil {
+		return err
+	}
+
+	job.RequestFingerprint = request.Fingerprint()
+	job.PresetName = request.Preset
+	job.Packaging = request.Packaging
+	job.AccessPolicy = request.AccessPolicy
+	if job.AccessPolicy == "" {
+		job.AccessPolicy = os.Getenv("DEFAULT_ACCESS_POLICY")
+	}
+	if job.AccessPolicy == "" {
+		job.AccessPolicy = domain.AccessPolicyBucketDefault
+	}
+
+	job.Video = video
+	job.OutputBucketPath = os.Getenv("OUTPUTBUCKETNAME")
+	job.ID = uuid.NewV4().String()
+	job.Status = domain.JobStarting
+	job.CreatedAt = time.Now()
+
+	jobService.Job = job
+	err = jobService.ApplyPreset()
+	if err != nil {
+		return err
+	}
+
+	err = job.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = jobService.JobRepository.Insert(job)
+	if err != nil {
+		return err
+	}
+
+	jobService.recordEvent("")
+	return nil
+}
+
+// resumableJob retorna o último job do mesmo arquivo com as mesmas opções do pedido se ele
+// falhou ou estourou o tempo limite, a menos que RESUME_FAILED_JOBS seja "false". Um pedido
+// com outras opções cria um novo job. Se a mensagem é uma nova tentativa e o último job foi
+// cancelado, retorna o job com ErrJobCancelled, para que ele não seja refeito; se o último
+// job foi concluído, retorna-o com errJobCompleted, pois só sua notificação falhou. Quando
+// não há job a retomar, o erro é gorm.ErrRecordNotFound ou errNotResumable.
+func resumableJob(repo repositories.JobRepository, request *messages.JobRequest, message amqp.Delivery) (*domain.Job, error) {
+	job, err := repo.FindLast(request.ResourceID, request.FilePath, request.Fingerprint())
+	if err != nil {
+		return nil, err
+	}
+
+	retried := queue.Attempts(message) > 0 || message.Redelivered
+	switch {
+	case job.Status == domain.JobCancelled && retried:
+		return job, ErrJobCancelled
+	case job.Status == domain.JobCompleted && retried:
+		return job, errJobCompleted
+	case !job.Status.Interrupted() || job.Status == domain.JobCancelled:
+		return nil, fmt.Errorf("%w: job %v is %s", errNotResumable, job.ID, job.Status)
+	case !resumeEnabled():
+		return nil, fmt.Errorf("%w: resuming failed jobs is disabled", errNotResumable)
+	}
+	return job, nil
+}
+
+// resumeEnabled informa se jobs que falharam são retomados, o que só não acontece quando
+// RESUME_FAILED_JOBS é "false".
+func resumeEnabled() bool {
+	resume, err := strconv.ParseBool(os.Getenv("RESUME_FAILED_JOBS"))
+	return err != nil || resume
+}
+
+// resumeJob reinicia um job que falhou, reaproveitando seu vídeo e seu workspace para que
+// Start pule as etapas já concluídas, e registra a retomada no histórico. Se o job não puder
+// ser preparado, ele volta a FAILED.
+func resumeJob(jobService *JobService, job *domain.Job) error {
+	log.Printf("resuming job %v from stages %v", job.ID, job.CompletedStages)
+
+	previous, stoppedAt, previousError := job.Status, job.UpdatedAt, job.Error
+	err := job.TransitionTo(domain.JobStarting)
+	if err != nil {
+		return err
+	}
+	job.Error = ""
+
+	jobService.VideoService.Video = job.Video
+	jobService.Job = job
+
+	_, err = jobService.JobRepository.Update(job)
+	if err != nil {
+		job.Status, job.Error = previous, previousError
+		return err
+	}
+
+	// O tempo registrado no evento é o que o job passou parado desde que foi interrompido.
+	jobService.stageStartedAt = stoppedAt
+	jobService.recordEvent(previous)
+
+	err = jobService.ApplyPreset()
+	if err == nil {
+		err = job.Validate()
+	}
+	if err != nil {
+		return jobService.failJob(err)
 	}
+	return nil
 }
 
 func returnJobResult(job domain.Job, message amqp.Delivery, err error) JobWorkerResult {
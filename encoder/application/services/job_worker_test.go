@@ -0,0 +1,245 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/repositories"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/database"
+	"github.com/zemartins81/encoderVideoGolang/framework/messages"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+func prepareJobServiceFactory(t *testing.T, store storage.ObjectStore) *services.JobServiceFactory {
+	db := database.NewDbTest()
+	t.Cleanup(func() { db.Close() })
+	// Cada conexão com o sqlite em memória abre um banco diferente.
+	db.DB().SetMaxOpenConns(1)
+
+	return &services.JobServiceFactory{
+		JobRepository:    &repositories.JobRepositoryDb{Db: db},
+		PresetRepository: repositories.NewPresetRepositoryDb(db),
+		VideoRepository:  repositories.NewVideoRepositoryDb(db),
+		InputStore:       store,
+		OutputStore:      storage.NewLocalStore(t.TempDir()),
+		Cancellations:    services.NewCancelRegistry(),
+	}
+}
+
+func TestJobWorkerRejectsInvalidRequests(t *testing.T) {
+	factory := prepareJobServiceFactory(t, storage.NewLocalStore(t.TempDir()))
+
+	result := processOne(factory, `{"resource_id": "resource", "packaging": "smooth"}`)
+	require.Empty(t, result.Job.ID)
+	require.ElementsMatch(t, []string{"file_path", "packaging"}, fieldNames(result.Error))
+}
+
+// processOne processa body com um único worker e retorna o resultado.
+func processOne(factory *services.JobServiceFactory, body string) services.JobWorkerResult {
+	messageChannel := make(chan amqp.Delivery, 1)
+	returnChannel := make(chan services.JobWorkerResult, 1)
+	messageChannel <- amqp.Delivery{Body: []byte(body)}
+	close(messageChannel)
+
+	services.JobWorker(messageChannel, returnChannel, factory, 0)
+	return <-returnChannel
+}
+
+func TestJobWorkerResumesOnlyMatchingRequests(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("INPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("RESUME_FAILED_JOBS", "")
+
+	// O arquivo não existe no bucket, então todos os jobs falham no download.
+	factory := prepareJobServiceFactory(t, storage.NewLocalStore(t.TempDir()))
+	request := `{"resource_id": "resource", "file_path": "emilly.mp4", "packaging": "dash"}`
+
+	failed := processOne(factory, request)
+	require.ErrorIs(t, failed.Error, storage.ErrObjectNotFound)
+
+	resumed := processOne(factory, request)
+	require.ErrorIs(t, resumed.Error, storage.ErrObjectNotFound)
+	require.Equal(t, failed.Job.ID, resumed.Job.ID)
+
+	events, err := factory.JobRepository.Timeline(failed.Job.ID)
+	require.Nil(t, err)
+	var statuses []domain.JobStatus
+	for _, event := range events {
+		statuses = append(statuses, event.Status)
+	}
+	require.Equal(t, []domain.JobStatus{
+		domain.JobStarting, domain.JobDownloading, domain.JobFailed,
+		domain.JobStarting, domain.JobDownloading, domain.JobFailed,
+	}, statuses)
+	require.Equal(t, domain.JobFailed, events[3].FromStatus)
+
+	changed := processOne(factory, `{"resource_id": "resource", "file_path": "emilly.mp4", "packaging": "hls"}`)
+	require.NotEqual(t, failed.Job.ID, changed.Job.ID)
+	require.Equal(t, "hls", changed.Job.Packaging)
+}
+
+// missingPresets simula um preset que foi removido depois que o job foi criado.
+type missingPresets struct {
+	repositories.PresetRepository
+}
+
+func (missingPresets) FindByName(name string) (*domain.Preset, error) {
+	return nil, fmt.Errorf("preset %s not found", name)
+}
+
+func TestJobWorkerFailsJobThatCannotBeResumed(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("INPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("RESUME_FAILED_JOBS", "")
+
+	factory := prepareJobServiceFactory(t, storage.NewLocalStore(t.TempDir()))
+	preset, err := domain.NewPreset("web-hd", domain.DefaultRenditions())
+	require.Nil(t, err)
+	_, err = factory.PresetRepository.Insert(preset)
+	require.Nil(t, err)
+
+	request := `{"resource_id": "resource", "file_path": "emilly.mp4", "preset": "web-hd"}`
+	failed := processOne(factory, request)
+	require.ErrorIs(t, failed.Error, storage.ErrObjectNotFound)
+
+	factory.PresetRepository = missingPresets{factory.PresetRepository}
+	resumed := processOne(factory, request)
+	require.ErrorContains(t, resumed.Error, "preset web-hd not found")
+	require.Equal(t, failed.Job.ID, resumed.Job.ID)
+	require.Equal(t, domain.JobFailed, resumed.Job.Status)
+
+	job, err := factory.JobRepository.Find(failed.Job.ID)
+	require.Nil(t, err)
+	require.Equal(t, domain.JobFailed, job.Status)
+	require.Contains(t, job.Error, "preset web-hd not found")
+}
+
+// brokenJobs simula um banco fora do ar na busca pelo job a retomar.
+type brokenJobs struct {
+	repositories.JobRepository
+}
+
+func (brokenJobs) FindLast(resourceID string, filePath string, fingerprint string) (*domain.Job, error) {
+	return nil, errors.New("database is unavailable")
+}
+
+func TestJobWorkerDoesNotCreateJobWhenLookupFails(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("INPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+
+	factory := prepareJobServiceFactory(t, storage.NewLocalStore(t.TempDir()))
+	jobs := factory.JobRepository
+	factory.JobRepository = brokenJobs{jobs}
+
+	result := processOne(factory, `{"resource_id": "resource", "file_path": "emilly.mp4"}`)
+	require.ErrorContains(t, result.Error, "database is unavailable")
+	require.Empty(t, result.Job.ID)
+
+	_, err := jobs.FindLast("resource", "emilly.mp4", "")
+	require.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+func TestJobWorkerRenotifiesRedeliveredCompletedJobs(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+
+	factory := prepareJobServiceFactory(t, storage.NewLocalStore(t.TempDir()))
+	body := `{"resource_id": "resource", "file_path": "emilly.mp4"}`
+	request, err := messages.ParseJobRequest([]byte(body))
+	require.Nil(t, err)
+
+	video := request.Video()
+	video.ID = "video-id"
+	_, err = factory.VideoRepository.Insert(video)
+	require.Nil(t, err)
+	job, err := domain.NewJob("encodervideotest", domain.JobCompleted, video)
+	require.Nil(t, err)
+	job.RequestFingerprint = request.Fingerprint()
+	_, err = factory.JobRepository.Insert(job)
+	require.Nil(t, err)
+
+	// A nova entrega da mensagem só refaz a notificação do job concluído.
+	messageChannel := make(chan amqp.Delivery, 1)
+	returnChannel := make(chan services.JobWorkerResult, 1)
+	messageChannel <- amqp.Delivery{Body: []byte(body), Redelivered: true}
+	close(messageChannel)
+	services.JobWorker(messageChannel, returnChannel, factory, 0)
+
+	result := <-returnChannel
+	require.Nil(t, result.Error)
+	require.Equal(t, job.ID, result.Job.ID)
+	require.Equal(t, domain.JobCompleted, result.Job.Status)
+}
+
+func fieldNames(err error) []string {
+	var names []string
+	for _, fieldError := range messages.FieldErrors(err) {
+		names = append(names, fieldError.Field)
+	}
+	return names
+}
+
+func TestJobWorkersProcessMessagesConcurrently(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	t.Setenv("INPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("OUTPUTBUCKETNAME", "encodervideotest")
+	t.Setenv("DEFAULT_PRESET", "")
+	t.Setenv("RESUME_FAILED_JOBS", "false")
+
+	const workers = 4
+	const messageCount = 12
+
+	store := storage.NewLocalStore(t.TempDir())
+	factory := prepareJobServiceFactory(t, store)
+
+	messageChannel := make(chan amqp.Delivery)
+	returnChannel := make(chan services.JobWorkerResult)
+	for i := 0; i < workers; i++ {
+		go services.JobWorker(messageChannel, returnChannel, factory, i)
+	}
+
+	var bodies [][]byte
+	for i := 0; i < messageCount; i++ {
+		filePath := fmt.Sprintf("video-%d.mp4", i)
+		err := store.Put(context.Background(), "encodervideotest", filePath, strings.NewReader(filePath), storage.PutOptions{})
+		require.Nil(t, err)
+		bodies = append(bodies, []byte(fmt.Sprintf(`{"resource_id":"resource-%d","file_path":"%s"}`, i, filePath)))
+	}
+
+	go func() {
+		for _, body := range bodies {
+			messageChannel <- amqp.Delivery{Body: body}
+		}
+		close(messageChannel)
+	}()
+
+	// O conteúdo dos vídeos é inválido, então todos os jobs falham depois do download.
+	jobIDs := map[string]bool{}
+	for i := 0; i < messageCount; i++ {
+		result := <-returnChannel
+		require.Error(t, result.Error)
+		require.NotNil(t, result.Job.Video)
+
+		resourceID := strings.TrimPrefix(result.Job.Video.ResourceID, "resource-")
+		require.Equal(t, "video-"+resourceID+".mp4", result.Job.Video.FilePath)
+		require.Contains(t, string(result.Message.Body), result.Job.Video.FilePath)
+		require.False(t, jobIDs[result.Job.ID])
+		jobIDs[result.Job.ID] = true
+	}
+	require.Len(t, jobIDs, messageCount)
+}
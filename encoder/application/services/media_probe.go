@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedMedia indica que o arquivo de entrada está corrompido ou usa um formato
+// que o pipeline não consegue processar.
+var ErrUnsupportedMedia = errors.New("unsupported media")
+
+var supportedVideoCodecs = map[string]bool{
+	"h264":       true,
+	"hevc":       true,
+	"vp8":        true,
+	"vp9":        true,
+	"av1":        true,
+	"mpeg4":      true,
+	"mpeg2video": true,
+	"prores":     true,
+}
+
+type probeOutput struct {
+	Streams []probeStream `json:"streams"`
+	Format  probeFormat   `json:"format"`
+}
+
+type probeStream struct {
+	CodecType     string `json:"codec_type"`
+	CodecName     string `json:"codec_name"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	AvgFrameRate  string `json:"avg_frame_rate"`
+	RFrameRate    string `json:"r_frame_rate"`
+	ChannelLayout string `json:"channel_layout"`
+}
+
+type probeFormat struct {
+	FormatName string `json:"format_name"`
+	Duration   string `json:"duration"`
+	BitRate    string `json:"bit_rate"`
+}
+
+// Probe analisa o vídeo baixado com o ffprobe, grava os metadados técnicos no Video e
+// rejeita com ErrUnsupportedMedia arquivos corrompidos ou sem suporte.
+func (v *VideoService) Probe(ctx context.Context) error {
+	source := os.Getenv("localStoragePath") + "/" + v.Video.ID + ".mp4"
+
+	cmd := command(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", source)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: ffprobe: %s", ErrUnsupportedMedia, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return err
+	}
+
+	err = v.ApplyProbe(output)
+	if err != nil {
+		return err
+	}
+
+	_, err = v.VideoRepository.Update(v.Video)
+	return err
+}
+
+// ApplyProbe preenche os metadados técnicos do Video a partir da saída JSON do ffprobe.
+func (v *VideoService) ApplyProbe(output []byte) error {
+	var probe probeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return fmt.Errorf("%w: invalid ffprobe output: %v", ErrUnsupportedMedia, err)
+	}
+
+	var video, audio *probeStream
+	for i := range probe.Streams {
+		stream := &probe.Streams[i]
+		if stream.CodecType == "video" && video == nil {
+			video = stream
+		}
+		if stream.CodecType == "audio" && audio == nil {
+			audio = stream
+		}
+	}
+
+	if video == nil {
+		return fmt.Errorf("%w: no video stream found", ErrUnsupportedMedia)
+	}
+	if !supportedVideoCodecs[video.CodecName] {
+		return fmt.Errorf("%w: video codec %q is not supported", ErrUnsupportedMedia, video.CodecName)
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return fmt.Errorf("%w: invalid video dimensions %dx%d", ErrUnsupportedMedia, video.Width, video.Height)
+	}
+
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("%w: invalid duration %q", ErrUnsupportedMedia, probe.Format.Duration)
+	}
+
+	frameRate := parseFrameRate(video.AvgFrameRate)
+	if frameRate == 0 {
+		frameRate = parseFrameRate(video.RFrameRate)
+	}
+
+	v.Video.Duration = duration
+	v.Video.Width = video.Width
+	v.Video.Height = video.Height
+	v.Video.FrameRate = frameRate
+	v.Video.VideoCodec = video.CodecName
+	v.Video.Container = probe.Format.FormatName
+	v.Video.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	v.Video.AudioCodec = ""
+	v.Video.ChannelLayout = ""
+	if audio != nil {
+		v.Video.AudioCodec = audio.CodecName
+		v.Video.ChannelLayout = audio.ChannelLayout
+	}
+
+	return nil
+}
+
+// parseFrameRate converte frações como "30000/1001" em quadros por segundo.
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	if !found {
+		value, _ := strconv.ParseFloat(rate, 64)
+		return value
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,53 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+const probeOutput = `{
+	"streams": [
+		{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "avg_frame_rate": "30000/1001", "r_frame_rate": "30000/1001"},
+		{"codec_type": "audio", "codec_name": "aac", "channel_layout": "stereo"}
+	],
+	"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "62.562000", "bit_rate": "4811230"}
+}`
+
+func TestVideoServiceApplyProbe(t *testing.T) {
+	videoService := services.NewVideoService()
+	videoService.Video = domain.NewVideo()
+
+	err := videoService.ApplyProbe([]byte(probeOutput))
+	require.Nil(t, err)
+
+	video := videoService.Video
+	require.Equal(t, 62.562, video.Duration)
+	require.Equal(t, 1920, video.Width)
+	require.Equal(t, 1080, video.Height)
+	require.InDelta(t, 29.97, video.FrameRate, 0.01)
+	require.Equal(t, "h264", video.VideoCodec)
+	require.Equal(t, "aac", video.AudioCodec)
+	require.Equal(t, "stereo", video.ChannelLayout)
+	require.Equal(t, "mov,mp4,m4a,3gp,3g2,mj2", video.Container)
+	require.Equal(t, int64(4811230), video.Bitrate)
+}
+
+func TestVideoServiceApplyProbeRejectsUnsupportedMedia(t *testing.T) {
+	videoService := services.NewVideoService()
+	videoService.Video = domain.NewVideo()
+
+	inputs := []string{
+		`not json`,
+		`{"streams": [{"codec_type": "audio", "codec_name": "aac"}], "format": {"duration": "10"}}`,
+		`{"streams": [{"codec_type": "video", "codec_name": "gif", "width": 10, "height": 10}], "format": {"duration": "10"}}`,
+		`{"streams": [{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080}], "format": {"duration": "N/A"}}`,
+	}
+
+	for _, input := range inputs {
+		err := videoService.ApplyProbe([]byte(input))
+		require.ErrorIs(t, err, services.ErrUnsupportedMedia, input)
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+// SpriteOptions configura as sprite sheets de pré-visualização: um quadro de Width x Height
+// a cada Interval segundos, organizados em grades de Columns x Rows por imagem.
+type SpriteOptions struct {
+	Interval float64
+	Width    int
+	Height   int
+	Columns  int
+	Rows     int
+}
+
+// Sprites gera em <id>/sprites as sprite sheets do vídeo e o arquivo sprites.vtt que
+// associa cada intervalo de tempo às coordenadas do quadro na sprite sheet. O caminho do
+// .vtt no bucket de saída é registrado no job.
+func (v *VideoService) Sprites(ctx context.Context, job *domain.Job, opts SpriteOptions) error {
+	root := os.Getenv("localStoragePath")
+	source := root + "/" + v.Video.ID + ".mp4"
+	dir := root + "/" + v.Video.ID + "/sprites"
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Cada quadro ocupa exatamente WidthxHeight na grade, com bordas quando a proporção do
+	// vídeo é diferente, para que as coordenadas da trilha WebVTT continuem válidas.
+	cell := ThumbnailSize{Width: opts.Width, Height: opts.Height}
+	filter := fmt.Sprintf("fps=1/%g,%s,tile=%dx%d", opts.Interval, cell.ScaleFilter(), opts.Columns, opts.Rows)
+	cmd := command(ctx, "ffmpeg", "-y", "-loglevel", "error", "-i", source, "-vf", filter, "-q:v", "3", dir+"/sprite-%03d.jpg")
+	output, err := cmd.CombinedOutput()
+	printOutput(output)
+	if err != nil {
+		return fmt.Errorf("error generating sprites: %w", err)
+	}
+
+	track := dir + "/sprites.vtt"
+	err = os.WriteFile(track, []byte(SpriteVTT(v.Video.Duration, opts)), 0644)
+	if err != nil {
+		return err
+	}
+
+	job.SpriteTrack = objectPath(root, track)
+	return nil
+}
+
+// SpriteVTT monta o WebVTT de thumbnails para um vídeo de duration segundos. Cada cue
+// aponta para a sprite sheet sprite-NNN.jpg gerada pelo filtro tile do ffmpeg, com as
+// coordenadas do quadro no fragmento #xywh.
+func SpriteVTT(duration float64, opts SpriteOptions) string {
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+
+	perSheet := opts.Columns * opts.Rows
+	frames := int(math.Ceil(duration / opts.Interval))
+
+	for i := 0; i < frames; i++ {
+		start := float64(i) * opts.Interval
+		end := math.Min(start+opts.Interval, duration)
+
+		position := i % perSheet
+		x := (position % opts.Columns) * opts.Width
+		y := (position / opts.Columns) * opts.Height
+
+		fmt.Fprintf(&vtt, "\n%s --> %s\n", vttTimestamp(start), vttTimestamp(end))
+		fmt.Fprintf(&vtt, "sprite-%03d.jpg#xywh=%d,%d,%d,%d\n", i/perSheet+1, x, y, opts.Width, opts.Height)
+	}
+
+	return vtt.String()
+}
+
+// vttTimestamp formata segundos no formato hh:mm:ss.mmm do WebVTT.
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
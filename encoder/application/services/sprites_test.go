@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+func TestSpriteVTT(t *testing.T) {
+	vtt := services.SpriteVTT(12.5, services.SpriteOptions{Interval: 5, Width: 160, Height: 90, Columns: 2, Rows: 1})
+
+	expected := `WEBVTT
+
+00:00:00.000 --> 00:00:05.000
+sprite-001.jpg#xywh=0,0,160,90
+
+00:00:05.000 --> 00:00:10.000
+sprite-001.jpg#xywh=160,0,160,90
+
+00:00:10.000 --> 00:00:12.500
+sprite-002.jpg#xywh=0,0,160,90
+`
+	require.Equal(t, expected, vtt)
+}
+
+func TestSpriteVTTLongVideo(t *testing.T) {
+	vtt := services.SpriteVTT(3725, services.SpriteOptions{Interval: 10, Width: 160, Height: 90, Columns: 10, Rows: 10})
+
+	require.Contains(t, vtt, "01:02:00.000 --> 01:02:05.000\nsprite-004.jpg#xywh=320,630,160,90\n")
+}
+
+func TestVideoServiceSprites(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+
+	video, repo := prepare(t)
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	generateVideo(t, video)
+
+	job, err := domain.NewJob("encodervideotest", "ENCODING", video)
+	require.Nil(t, err)
+
+	err = videoService.Sprites(context.Background(), job, services.SpriteOptions{Interval: 1, Width: 80, Height: 45, Columns: 2, Rows: 2})
+	require.Nil(t, err)
+
+	require.Equal(t, video.ID+"/sprites/sprites.vtt", job.SpriteTrack)
+	require.FileExists(t, os.Getenv("localStoragePath")+"/"+video.ID+"/sprites/sprite-001.jpg")
+	require.FileExists(t, os.Getenv("localStoragePath")+"/"+job.SpriteTrack)
+}
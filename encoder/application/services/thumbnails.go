@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+// ThumbnailSize é a resolução de uma série de thumbnails.
+type ThumbnailSize struct {
+	Width  int
+	Height int
+}
+
+// ScaleFilter retorna o filtro do ffmpeg que reduz o quadro para caber em WidthxHeight sem
+// distorcê-lo, centralizando-o com bordas.
+func (s ThumbnailSize) ScaleFilter() string {
+	return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		s.Width, s.Height, s.Width, s.Height)
+}
+
+// ParseThumbnailSizes lê uma lista de resoluções no formato "320x180,640x360".
+func ParseThumbnailSizes(s string) ([]ThumbnailSize, error) {
+	var sizes []ThumbnailSize
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var size ThumbnailSize
+		if _, err := fmt.Sscanf(item, "%dx%d", &size.Width, &size.Height); err != nil || size.Width <= 0 || size.Height <= 0 {
+			return nil, fmt.Errorf("invalid thumbnail size %q", item)
+		}
+		sizes = append(sizes, size)
+	}
+
+	return sizes, nil
+}
+
+// Thumbnails extrai do vídeo original um poster na resolução de origem e count thumbnails
+// igualmente espaçados em cada uma das resoluções informadas. As imagens são gravadas em
+// <id>/thumbnails, junto ao manifesto, e seus caminhos no bucket de saída são registrados
+// no job.
+func (v *VideoService) Thumbnails(ctx context.Context, job *domain.Job, count int, sizes []ThumbnailSize) error {
+	root := os.Getenv("localStoragePath")
+	source := root + "/" + v.Video.ID + ".mp4"
+	dir := root + "/" + v.Video.ID + "/thumbnails"
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	job.Poster = ""
+	job.Thumbnails = nil
+
+	poster := dir + "/poster.jpg"
+	err = extractFrame(ctx, source, poster, v.Video.Duration*0.1, "")
+	if err != nil {
+		return err
+	}
+	job.Poster = objectPath(root, poster)
+
+	for _, size := range sizes {
+		sizeDir := fmt.Sprintf("%s/%dx%d", dir, size.Width, size.Height)
+		err = os.MkdirAll(sizeDir, os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		for i := 1; i <= count; i++ {
+			at := v.Video.Duration * float64(i) / float64(count+1)
+			target := fmt.Sprintf("%s/thumb-%03d.jpg", sizeDir, i)
+			err = extractFrame(ctx, source, target, at, size.ScaleFilter())
+			if err != nil {
+				return err
+			}
+			job.Thumbnails = append(job.Thumbnails, objectPath(root, target))
+		}
+	}
+
+	return nil
+}
+
+// extractFrame grava em target o quadro do instante at (em segundos), aplicando o filtro
+// de escala quando informado.
+func extractFrame(ctx context.Context, source string, target string, at float64, scale string) error {
+	cmdArgs := []string{}
+	cmdArgs = append(cmdArgs, "-y", "-loglevel", "error")
+	cmdArgs = append(cmdArgs, "-ss", fmt.Sprintf("%.3f", at))
+	cmdArgs = append(cmdArgs, "-i", source)
+	cmdArgs = append(cmdArgs, "-frames:v", "1", "-q:v", "2")
+	if scale != "" {
+		cmdArgs = append(cmdArgs, "-vf", scale)
+	}
+	cmdArgs = append(cmdArgs, target)
+
+	cmd := command(ctx, "ffmpeg", cmdArgs...)
+	output, err := cmd.CombinedOutput()
+	printOutput(output)
+	if err != nil {
+		return fmt.Errorf("error extracting frame at %.3fs: %w", at, err)
+	}
+	return nil
+}
+
+// objectPath converte um caminho local dentro de root no nome do objeto no bucket de saída.
+func objectPath(root string, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
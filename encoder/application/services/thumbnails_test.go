@@ -0,0 +1,73 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+// generateVideo cria com o ffmpeg um vídeo de teste de 4 segundos em
+// localStoragePath/<id>.mp4, pulando o teste se o ffmpeg não estiver disponível.
+func generateVideo(t *testing.T, video *domain.Video) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not found in PATH")
+	}
+
+	target := os.Getenv("localStoragePath") + "/" + video.ID + ".mp4"
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error", "-f", "lavfi", "-i", "testsrc=duration=4:size=640x360:rate=25", target)
+	output, err := cmd.CombinedOutput()
+	require.Nil(t, err, string(output))
+
+	video.Duration = 4
+	video.Width = 640
+	video.Height = 360
+}
+
+func TestParseThumbnailSizes(t *testing.T) {
+	sizes, err := services.ParseThumbnailSizes("320x180, 640x360")
+	require.Nil(t, err)
+	require.Equal(t, []services.ThumbnailSize{{Width: 320, Height: 180}, {Width: 640, Height: 360}}, sizes)
+
+	_, err = services.ParseThumbnailSizes("320")
+	require.Error(t, err)
+
+	_, err = services.ParseThumbnailSizes("0x180")
+	require.Error(t, err)
+}
+
+func TestThumbnailSizeScaleFilter(t *testing.T) {
+	size := services.ThumbnailSize{Width: 320, Height: 180}
+	require.Equal(t, "scale=320:180:force_original_aspect_ratio=decrease,pad=320:180:(ow-iw)/2:(oh-ih)/2,setsar=1", size.ScaleFilter())
+}
+
+func TestVideoServiceThumbnails(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+
+	video, repo := prepare(t)
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	generateVideo(t, video)
+
+	job, err := domain.NewJob("encodervideotest", "THUMBNAILING", video)
+	require.Nil(t, err)
+
+	err = videoService.Thumbnails(context.Background(), job, 3, []services.ThumbnailSize{{Width: 160, Height: 90}})
+	require.Nil(t, err)
+
+	require.Equal(t, video.ID+"/thumbnails/poster.jpg", job.Poster)
+	require.Equal(t, domain.StringList{
+		video.ID + "/thumbnails/160x90/thumb-001.jpg",
+		video.ID + "/thumbnails/160x90/thumb-002.jpg",
+		video.ID + "/thumbnails/160x90/thumb-003.jpg",
+	}, job.Thumbnails)
+
+	for _, path := range append(job.Thumbnails, job.Poster) {
+		require.FileExists(t, os.Getenv("localStoragePath")+"/"+path)
+	}
+}
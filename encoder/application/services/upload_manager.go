@@ -2,18 +2,23 @@ package services
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
-	"cloud.google.com/go/storage"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
 )
 
 // VideoUpload é uma estrutura que representa um upload de vídeo. Ela contém uma lista de caminhos
-// para arquivos de vídeo, o caminho do vídeo, o bucket de saída e uma lista de erros.
+// para arquivos de vídeo, o caminho do vídeo, o bucket de saída, o armazenamento de objetos,
+// a política de retentativas e o relatório do upload.
 type VideoUpload struct {
 	// Paths é uma lista de caminhos para arquivos de vídeo.
 	Paths []string
@@ -21,27 +26,96 @@ type VideoUpload struct {
 	VideoPath string
 	// OutputBucket é o bucket de saída para o upload.
 	OutputBucket string
-	// Errors é uma lista de erros que ocorreram durante o upload.
-	Errors []string
+	// Store é o armazenamento de objetos onde os arquivos são enviados.
+	Store storage.ObjectStore
+	// ACL é a política de acesso aplicada a cada objeto enviado.
+	ACL storage.ACL
+	// URLExpiration é a validade das URLs assinadas geradas para os objetos enviados.
+	// Quando zero, nenhuma URL é gerada.
+	URLExpiration time.Duration
+	// MaxRetries é o número de novas tentativas de cada arquivo após a primeira falha.
+	MaxRetries int
+	// RetryDelay é a espera antes da primeira retentativa; ela dobra a cada nova tentativa.
+	RetryDelay time.Duration
+	// Report registra os objetos enviados e os erros ocorridos durante o upload.
+	Report *UploadReport
+}
+
+// UploadedObject descreve um objeto presente no bucket de saída ao final do upload.
+type UploadedObject struct {
+	// Key é o nome do objeto no bucket de saída.
+	Key string `json:"key"`
+	// Size é o tamanho do objeto em bytes.
+	Size int64 `json:"size"`
+	// MD5 é o MD5 do objeto em hexadecimal.
+	MD5 string `json:"md5"`
+	// CRC32C é o CRC32C do objeto em hexadecimal.
+	CRC32C string `json:"crc32c"`
+	// Skipped indica que o objeto já existia com o mesmo checksum e não foi reenviado.
+	Skipped bool `json:"skipped"`
+	// URL é a URL assinada do objeto, quando URLExpiration estiver definido.
+	URL string `json:"url,omitempty"`
+}
+
+// UploadReport é o relatório de um upload. Ele pode ser atualizado por vários workers
+// ao mesmo tempo.
+type UploadReport struct {
+	mu      sync.Mutex
+	objects []UploadedObject
+	errors  []string
+}
+
+// Objects retorna uma cópia da lista de objetos enviados.
+func (r *UploadReport) Objects() []UploadedObject {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]UploadedObject(nil), r.objects...)
+}
+
+// Errors retorna uma cópia da lista de erros ocorridos.
+func (r *UploadReport) Errors() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.errors...)
+}
+
+func (r *UploadReport) addObject(object UploadedObject) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.objects = append(r.objects, object)
+}
+
+func (r *UploadReport) addError(err string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
 }
 
 func NewVideoUpload() *VideoUpload {
-	return &VideoUpload{}
+	return &VideoUpload{
+		MaxRetries: 3,
+		RetryDelay: time.Second,
+		Report:     &UploadReport{},
+	}
 }
 
-// UploadObject envia um objeto para o bucket de saída, retornando um erro em caso de falha.
+// UploadObject envia um objeto para o bucket de saída com a política de acesso ACL e confere
+// o tamanho e os checksums do objeto gravado. Se o objeto já existir no bucket com o mesmo
+// conteúdo, o envio é ignorado. O objeto é registrado em Report, junto com sua URL assinada
+// quando URLExpiration estiver definido.
 //
 // Parâmetros:
 //   - objectpath: o caminho do objeto a ser enviado.
-//   - client: o cliente de armazenamento de objetos.
 //   - ctx: o contexto de execução.
 //
 // Retorno:
-//   - um erro se ocorrer um erro durante o envio.
-func (vu *VideoUpload) UploadObject(objectpath string, client *storage.Client, ctx context.Context) error {
-	// Divide o caminho do objeto em duas partes, a parte antes do caminho localStoragePath
-	// e a parte após ela.
-	path := strings.Split(objectpath, os.Getenv("localStoragePath")+"/")
+//   - um erro se ocorrer um erro durante o envio ou a verificação.
+func (vu *VideoUpload) UploadObject(objectpath string, ctx context.Context) error {
+	// O nome do objeto é o caminho do arquivo relativo a localStoragePath.
+	key, err := objectKey(objectpath)
+	if err != nil {
+		return err
+	}
 
 	// Abre o arquivo a ser enviado.
 	f, err := os.Open(objectpath)
@@ -50,28 +124,138 @@ func (vu *VideoUpload) UploadObject(objectpath string, client *storage.Client, c
 	}
 	defer f.Close()
 
-	// Cria um novo escritor de objetos no bucket de saída, definindo permissões de acesso.
-	wc := client.Bucket(vu.OutputBucket).Object(path[1]).NewWriter(ctx)
-	wc.ACL = []storage.ACLRule{
-		{
-			Entity: storage.AllUsers,
-			Role:   storage.RoleReader,
-		},
+	// Calcula os checksums do arquivo local.
+	h, err := storage.HashReader(f)
+	if err != nil {
+		return err
+	}
+
+	object := UploadedObject{
+		Key:    key,
+		Size:   h.Size(),
+		MD5:    hex.EncodeToString(h.MD5()),
+		CRC32C: fmt.Sprintf("%08x", h.CRC32C()),
 	}
 
-	// Copia o conteúdo do arquivo para o escritor de objetos.
-	if _, err = io.Copy(wc, f); err != nil {
+	// Ignora o envio se o objeto já estiver no bucket com o mesmo conteúdo, o que
+	// acontece quando um job é reprocessado. Sem checksum, o tamanho igual não basta e o
+	// objeto é enviado de novo.
+	if info, err := vu.Store.Stat(ctx, vu.OutputBucket, key); err == nil && info.HasChecksum() && info.Verify(h) == nil {
+		object.Skipped = true
+		return vu.registerObject(object, ctx)
+	}
+
+	// Volta ao início do arquivo para enviá-lo.
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Envia o conteúdo do arquivo para o bucket de saída.
+	if err = vu.Store.Put(ctx, vu.OutputBucket, key, f, storage.PutOptions{ACL: vu.ACL}); err != nil {
 		return err
 	}
 
-	// Fecha o escritor de objetos, retornando um erro em caso de falha.
-	if err := wc.Close(); err != nil {
+	// Confere se o objeto gravado corresponde ao arquivo local.
+	info, err := vu.Store.Stat(ctx, vu.OutputBucket, key)
+	if err != nil {
+		return err
+	}
+	if err = info.Verify(h); err != nil {
 		return err
 	}
 
+	return vu.registerObject(object, ctx)
+}
+
+// objectKey retorna o nome no bucket de saída do arquivo objectpath: seu caminho relativo a
+// localStoragePath. Arquivos fora de localStoragePath são recusados.
+func objectKey(objectpath string) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(os.Getenv("localStoragePath")), filepath.Clean(objectpath))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not under localStoragePath", objectpath)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Restore registra em Report, como ignorados, os objetos já enviados ao bucket de saída
+// cujo nome começa com prefix, com suas URLs assinadas quando URLExpiration estiver
+// definido. Os checksums que a listagem não traz são lidos com Stat; os que o
+// armazenamento não informa ficam vazios.
+func (vu *VideoUpload) Restore(ctx context.Context, prefix string) error {
+	infos, err := vu.Store.List(ctx, vu.OutputBucket, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if len(info.MD5) == 0 || !info.HasCRC32C {
+			stat, err := vu.Store.Stat(ctx, vu.OutputBucket, info.Key)
+			if err != nil {
+				return err
+			}
+			info = *stat
+		}
+
+		object := UploadedObject{
+			Key:     info.Key,
+			Size:    info.Size,
+			Skipped: true,
+		}
+		if len(info.MD5) > 0 {
+			object.MD5 = hex.EncodeToString(info.MD5)
+		}
+		if info.HasCRC32C {
+			object.CRC32C = fmt.Sprintf("%08x", info.CRC32C)
+		}
+
+		err = vu.registerObject(object, ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerObject gera a URL assinada do objeto, se configurada, e o adiciona ao relatório.
+func (vu *VideoUpload) registerObject(object UploadedObject, ctx context.Context) error {
+	if vu.URLExpiration > 0 {
+		signer, ok := vu.Store.(storage.URLSigner)
+		if !ok {
+			return fmt.Errorf("object store does not support signed URLs")
+		}
+
+		url, err := signer.SignedURL(ctx, vu.OutputBucket, object.Key, vu.URLExpiration)
+		if err != nil {
+			return err
+		}
+		object.URL = url
+	}
+
+	vu.Report.addObject(object)
 	return nil
 }
 
+// uploadWithRetry executa UploadObject, repetindo as tentativas que falharem até MaxRetries
+// vezes com espera exponencial entre elas. A espera é interrompida se ctx for cancelado.
+func (vu *VideoUpload) uploadWithRetry(objectpath string, ctx context.Context) error {
+	delay := vu.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := vu.UploadObject(objectpath, ctx)
+		if err == nil || attempt >= vu.MaxRetries {
+			return err
+		}
+
+		log.Printf("Error on upload: %v. Retrying in %v. Error: %v", objectpath, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
 // loadPaths é uma função que carrega os caminhos dos arquivos de vídeo no diretório
 // especificado em VideoPath, armazenando-os na lista Paths. Ele usa a função filepath.Walk
 // para percorrer o diretório e suas subpastas, filtrando apenas os arquivos, não as pastas.
@@ -81,6 +265,10 @@ func (vu *VideoUpload) UploadObject(objectpath string, client *storage.Client, c
 func (vu *VideoUpload) loadPaths() error {
 	// Percorre o diretório de vídeo, adicionando os caminhos de arquivos encontrados à lista Paths.
 	err := filepath.Walk(vu.VideoPath, func(path string, info os.FileInfo, err error) error {
+		// Interrompe a iteração caso o caminho não possa ser lido.
+		if err != nil {
+			return err
+		}
 		// Verifica se o arquivo atual é uma pasta, ignorando-a.
 		if !info.IsDir() {
 			// Adiciona o caminho do arquivo à lista Paths.
@@ -97,60 +285,41 @@ func (vu *VideoUpload) loadPaths() error {
 	return nil
 }
 
-// getClientUpload retorna um cliente de armazenamento, um contexto e um erro.
-// Ele cria um contexto em Background, conecta com a API do GCP e retorna um cliente
-// para acessar o serviço de armazenamento de objetos.
-//
-// Retorno:
-//   - cliente de armazenamento de objetos
-//   - contexto de execução
-//   - erro, em caso de falha na conexão com a API do GCP
-func getClientUpload() (*storage.Client, context.Context, error) {
-	// Cria um contexto em Background.
-	ctx := context.Background()
-
-	// Cria um novo cliente de armazenamento de objetos, conectando com a API do GCP.
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		// Retorna o erro ocorrido durante a conexão com a API do GCP.
-		return nil, nil, err
-	}
-
-	// Retorna o cliente de armazenamento de objetos, o contexto de execução e nulo, indicando que a função foi concluída com sucesso.
-	return client, ctx, nil
-}
-
 // ProcessUpload é uma função que inicia o processo de upload dos vídeos.
-// Ela carrega os caminhos dos arquivos, obtém um cliente de armazenamento e
-// inicia uma série de workers que realizam o upload dos arquivos.
+// Ela carrega os caminhos dos arquivos e inicia uma série de workers que
+// realizam o upload dos arquivos através de Store. Ao final, envia "upload completed"
+// em doneUpload ou, se algum arquivo falhar após todas as tentativas, a lista de erros.
 //
 // Parâmetros:
-//   - concurrency: número de workers que serão iniciados simultaneamente.
+//   - concurrency: número de workers que serão iniciados simultaneamente; no mínimo 1.
 //   - doneUpload: canal de saída para informar se o upload foi concluído.
+//   - ctx: o contexto de execução; ao ser cancelado, os uploads pendentes são interrompidos.
 //
 // Retorno:
 //   - erro, caso ocorra durante a execução do processo.
-func (vu *VideoUpload) ProcessUpload(concurrency int, doneUpload chan string) error {
+func (vu *VideoUpload) ProcessUpload(concurrency int, doneUpload chan string, ctx context.Context) error {
 	// Cria um canal para receber os índices dos arquivos a serem enviados.
 	in := make(chan int, runtime.NumCPU())
-	// Cria um canal para receber as respostas dos workers após o upload.
-	returnChannel := make(chan string)
 
 	// Carrega os caminhos dos arquivos a serem enviados.
 	err := vu.loadPaths()
 	if err != nil {
+		doneUpload <- err.Error()
 		return err
 	}
 
-	// Obtém um cliente de armazenamento para acessar o serviço de armazenamento de objetos.
-	uploadClient, ctx, err := getClientUpload()
-	if err != nil {
-		return err
+	// Cria um canal para receber as respostas dos workers após o upload, com espaço para
+	// todas elas, para que os workers não fiquem presos se a espera for cancelada.
+	returnChannel := make(chan string, len(vu.Paths))
+
+	// Sem workers nenhum arquivo seria enviado e a espera abaixo nunca terminaria.
+	if concurrency < 1 {
+		concurrency = 1
 	}
 
 	// Inicia os workers para realizar o upload dos arquivos.
 	for process := 0; process < concurrency; process++ {
-		go vu.upLoadWorker(in, returnChannel, uploadClient, ctx)
+		go vu.upLoadWorker(in, returnChannel, ctx)
 	}
 
 	// Envia os índices dos arquivos para o canal de entrada dos workers.
@@ -161,39 +330,45 @@ func (vu *VideoUpload) ProcessUpload(concurrency int, doneUpload chan string) er
 		close(in)
 	}()
 
-	// Espera pela resposta dos workers após o upload.
-	for r := range returnChannel {
-		// Se uma resposta for diferente de vazia, significa que ocorreu um erro durante o upload.
-		if r != "" {
-			doneUpload <- r
-			break
+	// Espera pela resposta dos workers para cada um dos arquivos.
+	for x := 0; x < len(vu.Paths); x++ {
+		select {
+		case <-returnChannel:
+		case <-ctx.Done():
+			doneUpload <- ctx.Err().Error()
+			return ctx.Err()
 		}
 	}
 
+	// Se algum arquivo falhou após todas as tentativas, informa os erros.
+	if failures := vu.Report.Errors(); len(failures) > 0 {
+		doneUpload <- fmt.Sprintf("upload failed for %d object(s): %s", len(failures), strings.Join(failures, "; "))
+		return nil
+	}
+
+	doneUpload <- "upload completed"
 	return nil
 }
 
 // upLoadWorker é uma função que executa o upload de um arquivo. Ela recebe um canal de entrada para
-// receber os índices dos arquivos, um canal de retorno para enviar as respostas após o upload,
-// um cliente de armazenamento e um contexto. Ela inicia um loop onde espera um índice do
-// canal de entrada, faz o upload do arquivo correspondente e envia uma resposta ao canal de retorno.
-// Quando o canal de entrada for fechado, a função envia "upload completed" ao canal de retorno.
-func (vu *VideoUpload) upLoadWorker(in chan int, returnChan chan string, uploadClient *storage.Client, ctx context.Context) {
+// receber os índices dos arquivos, um canal de retorno para enviar as respostas após o upload
+// e um contexto. Ela inicia um loop onde espera um índice do
+// canal de entrada, faz o upload do arquivo correspondente e envia uma resposta ao canal de retorno:
+// vazia em caso de sucesso ou a mensagem de erro após esgotar as tentativas.
+func (vu *VideoUpload) upLoadWorker(in chan int, returnChan chan string, ctx context.Context) {
 
 	// Loop que espera os índices dos arquivos a serem enviados.
 	for x := range in {
 		// Faz o upload do arquivo correspondente ao índice recebido.
-		err := vu.UploadObject(vu.Paths[x], uploadClient, ctx)
-		// Se ocorrer um erro durante o upload, o índice do arquivo é adicionado à lista de erros.
+		err := vu.uploadWithRetry(vu.Paths[x], ctx)
+		// Se o upload falhar após todas as tentativas, o erro é adicionado ao relatório.
 		if err != nil {
-			vu.Errors = append(vu.Errors, vu.Paths[x])
+			vu.Report.addError(fmt.Sprintf("%v: %v", vu.Paths[x], err))
 			log.Printf("Error on upload: %v. Error: %v", vu.Paths[x], err)
 			returnChan <- err.Error()
+			continue
 		}
 		// Envia uma resposta vazia para indicar que o upload foi concluído com sucesso.
 		returnChan <- ""
 	}
-
-	// Envia "upload completed" quando o canal de entrada for fechado.
-	returnChan <- "upload completed"
 }
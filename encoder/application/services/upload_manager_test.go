@@ -1,46 +1,207 @@
 package services_test
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/require"
 	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
 )
 
-func init() {
-	err := godotenv.Load("../../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
+// flakyStore falha as primeiras chamadas a Put de cada objeto.
+type flakyStore struct {
+	*storage.LocalStore
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (s *flakyStore) Put(ctx context.Context, bucket string, key string, r io.Reader, opts storage.PutOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures[key] > 0 {
+		s.failures[key]--
+		return errors.New("connection reset")
 	}
+	return s.LocalStore.Put(ctx, bucket, key, r, opts)
+}
+
+// prepareUpload cria em localStoragePath os arquivos de um vídeo empacotado.
+func prepareUpload(t *testing.T) *services.VideoUpload {
+	localStoragePath := t.TempDir()
+	t.Setenv("localStoragePath", localStoragePath)
+
+	videoPath := filepath.Join(localStoragePath, "video-id")
+	require.Nil(t, os.MkdirAll(filepath.Join(videoPath, "video", "avc1"), os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(videoPath, "stream.mpd"), []byte("mpd"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(videoPath, "video", "avc1", "seg-1.m4s"), []byte("segment"), 0644))
+
+	videoUpload := services.NewVideoUpload()
+	videoUpload.OutputBucket = "encodervideotest"
+	videoUpload.VideoPath = videoPath
+	videoUpload.Store = storage.NewLocalStore(t.TempDir())
+	videoUpload.RetryDelay = time.Millisecond
+
+	return videoUpload
 }
 
 func TestVideoServiceUpload(t *testing.T) {
-	video, repo := prepare()
-	videoService := services.NewVideoService()
-	videoService.Video = video
-	videoService.VideoRepository = repo
+	videoUpload := prepareUpload(t)
 
-	err := videoService.Download("encodervideotest")
-	require.Nil(t, err)
+	doneUpload := make(chan string)
 
-	err = videoService.Fragment()
-	require.Nil(t, err)
+	go videoUpload.ProcessUpload(2, doneUpload, context.Background())
 
-	err = videoService.Encode()
+	result := <-doneUpload
+	require.Equal(t, result, "upload completed")
+
+	info, err := videoUpload.Store.Stat(context.Background(), "encodervideotest", "video-id/video/avc1/seg-1.m4s")
 	require.Nil(t, err)
+	require.Equal(t, int64(7), info.Size)
 
-	videoUpload := services.NewVideoUpload()
-	videoUpload.OutputBucket = "encodervideotest"
-	videoUpload.VideoPath = os.Getenv("localStoragePath") + "/" + video.ID
+	objects := videoUpload.Report.Objects()
+	require.Len(t, objects, 2)
+	for _, object := range objects {
+		require.False(t, object.Skipped)
+		require.NotEmpty(t, object.MD5)
+		require.NotEmpty(t, object.CRC32C)
+	}
+}
+
+func TestVideoUploadWithoutConcurrencyUsesOneWorker(t *testing.T) {
+	videoUpload := prepareUpload(t)
 
 	doneUpload := make(chan string)
+	go videoUpload.ProcessUpload(0, doneUpload, context.Background())
 
-	go videoUpload.ProcessUpload(50, doneUpload)
+	select {
+	case result := <-doneUpload:
+		require.Equal(t, "upload completed", result)
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload did not finish without concurrency")
+	}
+	require.Len(t, videoUpload.Report.Objects(), 2)
+}
+
+func TestVideoUploadSkipsExistingObjects(t *testing.T) {
+	videoUpload := prepareUpload(t)
+	store := videoUpload.Store
+
+	doneUpload := make(chan string)
+	go videoUpload.ProcessUpload(2, doneUpload, context.Background())
+	require.Equal(t, "upload completed", <-doneUpload)
+
+	retry := services.NewVideoUpload()
+	retry.OutputBucket = videoUpload.OutputBucket
+	retry.VideoPath = videoUpload.VideoPath
+	retry.Store = store
+
+	go retry.ProcessUpload(2, doneUpload, context.Background())
+	require.Equal(t, "upload completed", <-doneUpload)
+
+	for _, object := range retry.Report.Objects() {
+		require.True(t, object.Skipped)
+	}
+}
+
+func TestVideoUploadRetriesFailedObjects(t *testing.T) {
+	videoUpload := prepareUpload(t)
+	videoUpload.Store = &flakyStore{
+		LocalStore: storage.NewLocalStore(t.TempDir()),
+		failures:   map[string]int{"video-id/stream.mpd": 2, "video-id/video/avc1/seg-1.m4s": 5},
+	}
+
+	doneUpload := make(chan string)
+	go videoUpload.ProcessUpload(2, doneUpload, context.Background())
 
 	result := <-doneUpload
-	require.Equal(t, result, "upload completed")
+	require.Contains(t, result, "upload failed for 1 object(s)")
+	require.Len(t, videoUpload.Report.Objects(), 1)
+	require.Equal(t, "video-id/stream.mpd", videoUpload.Report.Objects()[0].Key)
+	require.Len(t, videoUpload.Report.Errors(), 1)
+}
+
+func TestVideoUploadSignsObjectURLs(t *testing.T) {
+	videoUpload := prepareUpload(t)
+	videoUpload.ACL = storage.ACLPrivate
+	videoUpload.URLExpiration = time.Hour
+
+	doneUpload := make(chan string)
+	go videoUpload.ProcessUpload(2, doneUpload, context.Background())
+	require.Equal(t, "upload completed", <-doneUpload)
+
+	for _, object := range videoUpload.Report.Objects() {
+		require.True(t, strings.HasPrefix(object.URL, "file://"))
+		require.True(t, strings.HasSuffix(object.URL, object.Key))
+	}
+}
+
+func TestVideoUploadStopsRetryingWhenCancelled(t *testing.T) {
+	videoUpload := prepareUpload(t)
+	videoUpload.Store = &flakyStore{
+		LocalStore: storage.NewLocalStore(t.TempDir()),
+		failures:   map[string]int{"video-id/stream.mpd": 1},
+	}
+	videoUpload.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneUpload := make(chan string)
+	go videoUpload.ProcessUpload(2, doneUpload, ctx)
 
+	time.AfterFunc(10*time.Millisecond, cancel)
+	select {
+	case result := <-doneUpload:
+		require.Contains(t, result, context.Canceled.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload did not stop after cancellation")
+	}
+}
+
+func TestVideoUploadRejectsFilesOutsideLocalStoragePath(t *testing.T) {
+	videoUpload := prepareUpload(t)
+
+	outside := filepath.Join(t.TempDir(), "stream.mpd")
+	require.Nil(t, os.WriteFile(outside, []byte("mpd"), 0644))
+
+	err := videoUpload.UploadObject(outside, context.Background())
+	require.Error(t, err)
+	require.Empty(t, videoUpload.Report.Objects())
+}
+
+func TestVideoUploadRestoreReportsChecksums(t *testing.T) {
+	videoUpload := prepareUpload(t)
+
+	doneUpload := make(chan string)
+	go videoUpload.ProcessUpload(1, doneUpload, context.Background())
+	require.Equal(t, "upload completed", <-doneUpload)
+	uploaded := videoUpload.Report.Objects()
+
+	restored := services.NewVideoUpload()
+	restored.OutputBucket = videoUpload.OutputBucket
+	restored.Store = videoUpload.Store
+	require.Nil(t, restored.Restore(context.Background(), "video-id/"))
+
+	objects := restored.Report.Objects()
+	require.Len(t, objects, len(uploaded))
+	for _, object := range objects {
+		require.NotEmpty(t, object.MD5)
+		require.NotEmpty(t, object.CRC32C)
+		require.True(t, object.Skipped)
+	}
+	require.ElementsMatch(t, checksums(uploaded), checksums(objects))
+}
+
+func checksums(objects []services.UploadedObject) []string {
+	sums := make([]string, 0, len(objects))
+	for _, object := range objects {
+		sums = append(sums, object.Key+" "+object.MD5+" "+object.CRC32C)
+	}
+	return sums
 }
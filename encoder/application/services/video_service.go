@@ -2,91 +2,266 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 
-	"cloud.google.com/go/storage"
 	"github.com/zemartins81/encoderVideoGolang/application/repositories"
 	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/drm"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
 )
 
+const (
+	downloadAttempts   = 3
+	masterPlaylistName = "master.m3u8"
+)
+
+// ErrEncryptionUnsupported indica um preset com criptografia em um empacotamento que não
+// a suporta.
+var ErrEncryptionUnsupported = errors.New("encryption requires dash or dash+hls packaging")
+
 type VideoService struct {
 	Video           *domain.Video
 	VideoRepository repositories.VideoRepository
+	Store           storage.ObjectStore
+	ContentKey      *drm.ContentKey
 }
 
 func NewVideoService() VideoService {
 	return VideoService{}
 }
 
-func (v *VideoService) Download(bucketName string) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+func (v *VideoService) Download(ctx context.Context, bucketName string) error {
+	info, err := v.Store.Stat(ctx, bucketName, v.Video.FilePath)
 	if err != nil {
 		return err
 	}
 
-	bkt := client.Bucket(bucketName)
-	obj := bkt.Object(v.Video.FilePath)
+	target := os.Getenv("localStoragePath") + "/" + v.Video.ID + ".mp4"
+	partial := target + ".part"
+
+	var h *storage.Hasher
+	for attempt := 1; ; attempt++ {
+		h, err = v.downloadPartial(ctx, bucketName, info, partial)
+		if err == nil {
+			break
+		}
+		if attempt == downloadAttempts || ctx.Err() != nil {
+			os.Remove(partial)
+			return err
+		}
+		log.Printf("download of video %v interrupted, resuming: %v", v.Video.ID, err)
+	}
 
-	r, err := obj.NewReader(ctx)
+	err = info.Verify(h)
 	if err != nil {
+		os.Remove(partial)
 		return err
 	}
-	defer r.Close()
 
-	body, err := io.ReadAll(r)
+	err = os.Rename(partial, target)
 	if err != nil {
+		os.Remove(partial)
 		return err
 	}
 
-	f, err := os.Create(os.Getenv("localStoragePath") + "/" + v.Video.ID + ".mp4")
+	log.Printf("video %v has been saved", v.Video.ID)
+	return nil
+
+}
+
+// downloadPartial continua o download do objeto a partir do tamanho atual do arquivo
+// parcial, retornando os checksums do arquivo inteiro.
+func (v *VideoService) downloadPartial(ctx context.Context, bucketName string, info *storage.ObjectInfo, partial string) (*storage.Hasher, error) {
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer f.Close()
 
-	_, err = f.Write(body)
+	h, err := storage.HashReader(f)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
 
-	log.Printf("video %v has been saved", v.Video.ID)
-	return nil
+	if h.Size() > info.Size {
+		if err = f.Truncate(0); err != nil {
+			return nil, err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		h = storage.NewHasher()
+	}
 
-}
+	if h.Size() == info.Size {
+		return h, nil
+	}
 
-func (v *VideoService) Fragment() error {
-	err := os.Mkdir(os.Getenv("localStoragePath")+"/"+v.Video.ID, os.ModePerm)
+	r, err := v.Store.Get(ctx, bucketName, v.Video.FilePath, h.Size())
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer r.Close()
 
+	if _, err = io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Transcode gera com o ffmpeg um MP4 para cada rendition do preset do job, nomeado
+// <id>_<rendition>.mp4, usando os codecs do preset. Os keyframes são forçados a cada
+// SegmentDuration segundos em todas as renditions, alinhando os segmentos entre os
+// níveis de qualidade. Renditions maiores que o vídeo de origem são ignoradas, e a proporção
+// do vídeo é mantida.
+func (v *VideoService) Transcode(ctx context.Context, job *domain.Job) error {
+	preset := job.Preset
 	source := os.Getenv("localStoragePath") + "/" + v.Video.ID + ".mp4"
-	target := os.Getenv("localStoragePath") + "/" + v.Video.ID + ".frag"
 
-	cmd := exec.Command("mp4fragment", source, target)
-	output, err := cmd.CombinedOutput()
+	for _, rendition := range v.renditionsFor(preset) {
+		scale := rendition.ScaleFilter(v.Video.Width, v.Video.Height)
+
+		cmdArgs := []string{}
+		cmdArgs = append(cmdArgs, "-y", "-loglevel", "error")
+		cmdArgs = append(cmdArgs, "-i", source)
+		cmdArgs = append(cmdArgs, "-map", "0:v:0", "-map", "0:a:0?")
+		cmdArgs = append(cmdArgs, "-c:v", preset.VideoCodec)
+		// O perfil main é o do x264; o libx265 usa seu próprio perfil padrão.
+		if preset.VideoCodec == "libx264" {
+			cmdArgs = append(cmdArgs, "-profile:v", "main")
+		}
+		cmdArgs = append(cmdArgs, "-pix_fmt", "yuv420p")
+		cmdArgs = append(cmdArgs, "-vf", scale)
+		cmdArgs = append(cmdArgs, "-b:v", fmt.Sprintf("%dk", rendition.VideoBitrate))
+		cmdArgs = append(cmdArgs, "-maxrate", fmt.Sprintf("%dk", rendition.VideoBitrate*107/100))
+		cmdArgs = append(cmdArgs, "-bufsize", fmt.Sprintf("%dk", rendition.VideoBitrate*2))
+		cmdArgs = append(cmdArgs, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", preset.SegmentDuration))
+		cmdArgs = append(cmdArgs, "-sc_threshold", "0")
+		cmdArgs = append(cmdArgs, "-c:a", preset.AudioCodec, "-ac", "2")
+		cmdArgs = append(cmdArgs, "-b:a", fmt.Sprintf("%dk", rendition.AudioBitrate))
+		cmdArgs = append(cmdArgs, v.renditionPath(rendition.Name)+".mp4")
+
+		cmd := command(ctx, "ffmpeg", cmdArgs...)
+		output, err := cmd.CombinedOutput()
+		printOutput(output)
+		if err != nil {
+			return fmt.Errorf("error transcoding rendition %s: %w", rendition.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// renditionsFor retorna as renditions do preset que não excedem o lado menor do vídeo de
+// origem, mantendo ao menos a menor delas.
+func (v *VideoService) renditionsFor(preset *domain.Preset) domain.Renditions {
+	return preset.Renditions.For(v.Video.Width, v.Video.Height)
+}
+
+// Fragment fragmenta com o mp4fragment cada rendition do preset gerada por Transcode ou,
+// se o preset não tiver renditions, o vídeo original, em fragmentos com a duração de
+// segmento do preset.
+func (v *VideoService) Fragment(ctx context.Context, job *domain.Job) error {
+	err := os.MkdirAll(os.Getenv("localStoragePath")+"/"+v.Video.ID, os.ModePerm)
 	if err != nil {
 		return err
 	}
-	printOutput(output)
+
+	for _, source := range v.renditionFiles(job.Preset, ".mp4") {
+		target := strings.TrimSuffix(source, ".mp4") + ".frag"
+
+		fragmentDuration := strconv.Itoa(job.Preset.SegmentDuration * 1000)
+		cmd := command(ctx, "mp4fragment", "--fragment-duration", fragmentDuration, source, target)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return err
+		}
+		printOutput(output)
+	}
+
 	return nil
 
 }
 
-func (v *VideoService) Encode() error {
-	cmdArgs := []string{}
-	cmdArgs = append(cmdArgs, os.Getenv("localStoragePath")+"/"+v.Video.ID+".frag")
-	cmdArgs = append(cmdArgs, "--use-segment-timeline")
-	cmdArgs = append(cmdArgs, "-o")
-	cmdArgs = append(cmdArgs, os.Getenv("localStoragePath")+"/"+v.Video.ID)
-	cmdArgs = append(cmdArgs, "-f")
-	cmdArgs = append(cmdArgs, "--exec-dir")
-	cmdArgs = append(cmdArgs, "/opt/bento4/bin")
-	cmd := exec.Command("mp4dash", cmdArgs...)
+// renditionPath retorna o caminho local, sem extensão, dos arquivos de uma rendition.
+func (v *VideoService) renditionPath(name string) string {
+	return os.Getenv("localStoragePath") + "/" + v.Video.ID + "_" + name
+}
+
+// renditionFiles retorna os arquivos com a extensão informada das renditions do preset
+// que Transcode gera para o vídeo ou, se o preset não tiver renditions, o arquivo do vídeo
+// original com essa extensão. Arquivos de outras renditions que tenham sobrado no
+// workspace, como os de uma escada anterior em um job retomado, são ignorados.
+func (v *VideoService) renditionFiles(preset *domain.Preset, ext string) []string {
+	if preset == nil || len(preset.Renditions) == 0 {
+		return []string{os.Getenv("localStoragePath") + "/" + v.Video.ID + ext}
+	}
+
+	renditions := v.renditionsFor(preset)
+	files := make([]string, 0, len(renditions))
+	for _, rendition := range renditions {
+		files = append(files, v.renditionPath(rendition.Name)+ext)
+	}
+	return files
+}
+
+// Encode empacota o vídeo fragmentado no formato escolhido em job.Packaging: DASH com
+// mp4dash, HLS com segmentos TS via mp4hls ou DASH e HLS com segmentos fMP4 compartilhados
+// via mp4dash --hls, sempre com segmentos da duração definida no preset. As legendas baixadas por DownloadCaptions entram como faixas de texto.
+// Se o preset pedir criptografia, o conteúdo é protegido com ContentKey no esquema do preset.
+// Os caminhos do manifesto e das playlists geradas são registrados no job.
+func (v *VideoService) Encode(ctx context.Context, job *domain.Job) error {
+	var cmd *exec.Cmd
+
+	inputs := v.renditionFiles(job.Preset, ".frag")
+
+	captions, err := v.captionInputs()
+	if err != nil {
+		return err
+	}
+	inputs = append(inputs, captions...)
+
+	encryption, err := v.encryptionArgs(job)
+	if err != nil {
+		return err
+	}
+
+	switch job.Packaging {
+	case domain.PackagingHLS:
+		cmdArgs := []string{}
+		cmdArgs = append(cmdArgs, "--output-dir")
+		cmdArgs = append(cmdArgs, os.Getenv("localStoragePath")+"/"+v.Video.ID)
+		cmdArgs = append(cmdArgs, "--segment-duration")
+		cmdArgs = append(cmdArgs, strconv.Itoa(job.Preset.SegmentDuration))
+		cmdArgs = append(cmdArgs, "-f")
+		cmdArgs = append(cmdArgs, "--exec-dir")
+		cmdArgs = append(cmdArgs, "/opt/bento4/bin")
+		cmdArgs = append(cmdArgs, inputs...)
+		cmd = command(ctx, "mp4hls", cmdArgs...)
+	default:
+		cmdArgs := []string{}
+		cmdArgs = append(cmdArgs, inputs...)
+		cmdArgs = append(cmdArgs, encryption...)
+		cmdArgs = append(cmdArgs, "--use-segment-timeline")
+		if job.Packaging == domain.PackagingDASHHLS {
+			cmdArgs = append(cmdArgs, "--hls")
+		}
+		cmdArgs = append(cmdArgs, "-o")
+		cmdArgs = append(cmdArgs, os.Getenv("localStoragePath")+"/"+v.Video.ID)
+		cmdArgs = append(cmdArgs, "-f")
+		cmdArgs = append(cmdArgs, "--exec-dir")
+		cmdArgs = append(cmdArgs, "/opt/bento4/bin")
+		cmd = command(ctx, "mp4dash", cmdArgs...)
+	}
 
 	output, err := cmd.CombinedOutput()
 
@@ -96,8 +271,53 @@ func (v *VideoService) Encode() error {
 
 	printOutput(output)
 
-	return nil
+	return v.recordManifests(job)
+
+}
+
+// encryptionArgs retorna as opções de Common Encryption do mp4dash para o preset do job,
+// ou nenhuma se o preset não pedir criptografia.
+func (v *VideoService) encryptionArgs(job *domain.Job) ([]string, error) {
+	if job.Preset == nil || job.Preset.Encryption == "" || job.Preset.Encryption == domain.EncryptionNone {
+		return nil, nil
+	}
+	if job.Packaging == domain.PackagingHLS {
+		return nil, ErrEncryptionUnsupported
+	}
+	if v.ContentKey == nil {
+		return nil, fmt.Errorf("no content key for %s encryption", job.Preset.Encryption)
+	}
+
+	return []string{
+		"--encryption-key=" + v.ContentKey.KID + ":" + v.ContentKey.Key,
+		"--encryption-cenc-scheme=" + job.Preset.Encryption,
+	}, nil
+}
 
+// recordManifests procura no diretório de saída o manifesto DASH e as playlists HLS
+// geradas, registrando no job seus caminhos no bucket de saída.
+func (v *VideoService) recordManifests(job *domain.Job) error {
+	job.ManifestPath = ""
+	job.MasterPlaylist = ""
+	job.MediaPlaylists = nil
+
+	root := os.Getenv("localStoragePath")
+	return filepath.Walk(root+"/"+v.Video.ID, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+		case filepath.Ext(path) == ".mpd":
+			job.ManifestPath = objectPath(root, path)
+		case info.Name() == masterPlaylistName:
+			job.MasterPlaylist = objectPath(root, path)
+		case filepath.Ext(path) == ".m3u8":
+			job.MediaPlaylists = append(job.MediaPlaylists, objectPath(root, path))
+		}
+		return nil
+	})
 }
 
 func (v *VideoService) Finish() error {
@@ -107,12 +327,30 @@ func (v *VideoService) Finish() error {
 		return err
 	}
 
+	err = os.RemoveAll(os.Getenv("localStoragePath") + "/" + v.Video.ID + ".mp4.part")
+	if err != nil {
+		log.Println("error removing partial download:", v.Video.ID, ".mp4.part")
+		return err
+	}
+
 	err = os.RemoveAll(os.Getenv("localStoragePath") + "/" + v.Video.ID + ".frag")
 	if err != nil {
 		log.Println("error removing frag:", v.Video.ID, ".frag")
 		return err
 	}
 
+	renditions, err := filepath.Glob(v.renditionPath("*"))
+	if err != nil {
+		return err
+	}
+	for _, rendition := range renditions {
+		err = os.RemoveAll(rendition)
+		if err != nil {
+			log.Println("error removing rendition:", rendition)
+			return err
+		}
+	}
+
 	err = os.RemoveAll(os.Getenv("localStoragePath") + "/" + v.Video.ID)
 	if err != nil {
 		log.Println("error removing dir:", v.Video.ID)
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+func TestRenditionFilesIgnoresLeftoverRenditions(t *testing.T) {
+	t.Setenv("localStoragePath", t.TempDir())
+	root := os.Getenv("localStoragePath")
+
+	renditions, err := domain.ParseRenditions("360p:640x360:800:96,240p:426x240:400:64")
+	require.Nil(t, err)
+	preset, err := domain.NewPreset("test", renditions)
+	require.Nil(t, err)
+
+	v := NewVideoService()
+	v.Video = &domain.Video{ID: "video", Width: 1280, Height: 720}
+
+	// Sobra de uma escada anterior do mesmo job.
+	require.Nil(t, os.WriteFile(root+"/video_720p.frag", []byte("frag"), 0644))
+
+	require.Equal(t, []string{root + "/video_360p.frag", root + "/video_240p.frag"}, v.renditionFiles(preset, ".frag"))
+	require.Equal(t, []string{root + "/video.frag"}, v.renditionFiles(nil, ".frag"))
+}
@@ -1,7 +1,10 @@
 package services_test
 
 import (
-	"log"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,18 +15,17 @@ import (
 	"github.com/zemartins81/encoderVideoGolang/application/services"
 	"github.com/zemartins81/encoderVideoGolang/domain"
 	"github.com/zemartins81/encoderVideoGolang/framework/database"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
 )
 
 func init() {
-	err := godotenv.Load("../../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
+	// O .env é opcional: os testes usam o armazenamento local.
+	godotenv.Load("../../.env")
 }
 
-func prepare() (*domain.Video, *repositories.VideoRepositoryDb) {
+func prepare(t *testing.T) (*domain.Video, *repositories.VideoRepositoryDb) {
 	db := database.NewDbTest()
-	defer db.Close()
+	t.Cleanup(func() { db.Close() })
 
 	video := domain.NewVideo()
 	video.ID = uuid.NewV4().String()
@@ -35,21 +37,134 @@ func prepare() (*domain.Video, *repositories.VideoRepositoryDb) {
 	return video, repo
 }
 
+// prepareStore cria um armazenamento local com o vídeo de teste no bucket
+// "encodervideotest" e aponta localStoragePath para um diretório temporário.
+func prepareStore(t *testing.T, content []byte) storage.ObjectStore {
+	t.Setenv("localStoragePath", t.TempDir())
+
+	store := storage.NewLocalStore(t.TempDir())
+	err := store.Put(context.Background(), "encodervideotest", "emilly.mp4", strings.NewReader(string(content)), storage.PutOptions{})
+	require.Nil(t, err)
+
+	return store
+}
+
+// sampleVideo retorna o conteúdo de testdata/emilly.mp4, pulando o teste quando o
+// vídeo ou as ferramentas do Bento4 não estiverem disponíveis.
+func sampleVideo(t *testing.T) []byte {
+	for _, tool := range []string{"ffprobe", "ffmpeg", "mp4fragment", "mp4dash", "mp4hls"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found in PATH", tool)
+		}
+	}
+
+	content, err := os.ReadFile("testdata/emilly.mp4")
+	if err != nil {
+		t.Skip("testdata/emilly.mp4 not found")
+	}
+	return content
+}
+
 func TestVideoServiceDownload(t *testing.T) {
-	video, repo := prepare()
+	video, repo := prepare(t)
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	videoService.Store = prepareStore(t, []byte("video content"))
+
+	err := videoService.Download(context.Background(), "encodervideotest")
+	require.Nil(t, err)
+
+	content, err := os.ReadFile(os.Getenv("localStoragePath") + "/" + video.ID + ".mp4")
+	require.Nil(t, err)
+	require.Equal(t, "video content", string(content))
+}
+
+func TestVideoServiceDownloadResumesPartialFile(t *testing.T) {
+	video, repo := prepare(t)
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	videoService.Store = prepareStore(t, []byte("video content"))
+
+	target := os.Getenv("localStoragePath") + "/" + video.ID + ".mp4"
+	require.Nil(t, os.WriteFile(target+".part", []byte("video"), 0644))
+
+	err := videoService.Download(context.Background(), "encodervideotest")
+	require.Nil(t, err)
+
+	content, err := os.ReadFile(target)
+	require.Nil(t, err)
+	require.Equal(t, "video content", string(content))
+	require.NoFileExists(t, target+".part")
+}
+
+func TestVideoServiceDownloadRemovesCorruptPartialFile(t *testing.T) {
+	video, repo := prepare(t)
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	videoService.Store = prepareStore(t, []byte("video content"))
+
+	target := os.Getenv("localStoragePath") + "/" + video.ID + ".mp4"
+	require.Nil(t, os.WriteFile(target+".part", []byte("VIDEO"), 0644))
+
+	err := videoService.Download(context.Background(), "encodervideotest")
+	require.Error(t, err)
+	require.NoFileExists(t, target)
+	require.NoFileExists(t, target+".part")
+}
+
+func TestVideoServicePipeline(t *testing.T) {
+	video, repo := prepare(t)
 	videoService := services.NewVideoService()
 	videoService.Video = video
 	videoService.VideoRepository = repo
+	videoService.Store = prepareStore(t, sampleVideo(t))
+
+	err := videoService.Download(context.Background(), "encodervideotest")
+	require.Nil(t, err)
+
+	err = videoService.Probe(context.Background())
+	require.Nil(t, err)
+	require.NotZero(t, video.Duration)
+
+	renditions, err := domain.ParseRenditions("360p:640x360:800:96,240p:426x240:400:64")
+	require.Nil(t, err)
 
-	err := videoService.Download("encodervideotest")
+	job, err := domain.NewJob("encodervideotest", "ENCODING", video)
+	require.Nil(t, err)
+	job.Packaging = domain.PackagingDASHHLS
+	job.Preset, err = domain.NewPreset("test", renditions)
 	require.Nil(t, err)
 
-	err = videoService.Fragment()
+	err = videoService.Transcode(context.Background(), job)
 	require.Nil(t, err)
 
-	err = videoService.Encode()
+	err = videoService.Fragment(context.Background(), job)
 	require.Nil(t, err)
 
+	err = videoService.Encode(context.Background(), job)
+	require.Nil(t, err)
+	require.Equal(t, video.ID+"/stream.mpd", job.ManifestPath)
+	require.Equal(t, video.ID+"/master.m3u8", job.MasterPlaylist)
+	require.NotEmpty(t, job.MediaPlaylists)
+
 	err = videoService.Finish()
 	require.Nil(t, err)
 }
+
+func TestVideoServiceFinishRemovesPartialDownload(t *testing.T) {
+	video, repo := prepare(t)
+	videoService := services.NewVideoService()
+	videoService.Video = video
+	videoService.VideoRepository = repo
+	videoService.Store = prepareStore(t, []byte("video content"))
+
+	partial := os.Getenv("localStoragePath") + "/" + video.ID + ".mp4.part"
+	require.Nil(t, os.WriteFile(partial, []byte("video"), 0644))
+
+	err := videoService.Finish()
+	require.Nil(t, err)
+	require.NoFileExists(t, partial)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// defaultWorkspaceTTL é o tempo sem alterações após o qual o workspace de um vídeo é
+// considerado abandonado.
+const defaultWorkspaceTTL = 24 * time.Hour
+
+// workspaceTTL retorna WORKSPACE_TTL, ou o padrão de 24 horas. Deve ser maior que a soma
+// dos tempos limite das etapas e das esperas entre as tentativas, para que o workspace de
+// um job em andamento ou aguardando nova tentativa não seja removido.
+func workspaceTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("WORKSPACE_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultWorkspaceTTL
+	}
+	return ttl
+}
+
+// SweepWorkspaces remove de root os workspaces de vídeos que não são alterados há mais de
+// ttl: o vídeo original, as renditions e o diretório de saída. Eles sobram quando o job
+// falha e é repetido em outra instância, ou quando a instância para no meio do job. Só são
+// considerados os arquivos cujo nome começa com o ID de um vídeo. Retorna quantos
+// workspaces foram removidos.
+func SweepWorkspaces(root string, ttl time.Duration, now time.Time) (int, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+
+	workspaces := map[string][]string{}
+	lastModified := map[string]time.Time{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) < 36 {
+			continue
+		}
+		videoID := name[:36]
+		if _, err := uuid.FromString(videoID); err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		workspaces[videoID] = append(workspaces[videoID], filepath.Join(root, name))
+		if info.ModTime().After(lastModified[videoID]) {
+			lastModified[videoID] = info.ModTime()
+		}
+	}
+
+	removed := 0
+	for videoID, paths := range workspaces {
+		if now.Sub(lastModified[videoID]) < ttl {
+			continue
+		}
+		for _, path := range paths {
+			if err = os.RemoveAll(path); err != nil {
+				return removed, err
+			}
+		}
+		log.Printf("removed abandoned workspace of video %v", videoID)
+		removed++
+	}
+	return removed, nil
+}
+
+// sweepWorkspaces executa SweepWorkspaces em localStoragePath periodicamente até que done
+// seja fechado.
+func sweepWorkspaces(done chan struct{}) {
+	ttl := workspaceTTL()
+	interval := ttl / 4
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if _, err := SweepWorkspaces(os.Getenv("localStoragePath"), ttl, now); err != nil {
+				log.Printf("error sweeping workspaces: %v", err)
+			}
+		}
+	}
+}
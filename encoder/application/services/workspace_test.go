@@ -0,0 +1,40 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+)
+
+func TestSweepWorkspaces(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+
+	abandoned := uuid.NewV4().String()
+	running := uuid.NewV4().String()
+	for _, name := range []string{abandoned + ".mp4", abandoned + "_720p.mp4", running + ".mp4", running + "_720p.mp4", "notes.txt"} {
+		require.Nil(t, os.WriteFile(filepath.Join(root, name), []byte("content"), 0644))
+		require.Nil(t, os.Chtimes(filepath.Join(root, name), now.Add(-2*time.Hour), now.Add(-2*time.Hour)))
+	}
+	require.Nil(t, os.MkdirAll(filepath.Join(root, abandoned, "video"), os.ModePerm))
+	require.Nil(t, os.Chtimes(filepath.Join(root, abandoned), now.Add(-2*time.Hour), now.Add(-2*time.Hour)))
+	// Uma rendition alterada recentemente mantém o workspace inteiro.
+	require.Nil(t, os.Chtimes(filepath.Join(root, running+"_720p.mp4"), now, now))
+
+	removed, err := services.SweepWorkspaces(root, time.Hour, now)
+	require.Nil(t, err)
+	require.Equal(t, 1, removed)
+
+	entries, err := os.ReadDir(root)
+	require.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{running + ".mp4", running + "_720p.mp4", "notes.txt"}, names)
+}
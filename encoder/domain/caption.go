@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	CaptionFormatSRT    = "srt"
+	CaptionFormatWebVTT = "webvtt"
+	CaptionFormatTTML   = "ttml"
+)
+
+var captionLanguage = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// Caption é um arquivo de legendas de um idioma entregue junto ao vídeo, no formato SRT
+// ou WebVTT. Language é uma tag BCP 47, como "pt-BR".
+type Caption struct {
+	Language string `json:"language"`
+	FilePath string `json:"file_path"`
+}
+
+// Captions é a lista de legendas de um vídeo persistida como JSON em uma única coluna.
+type Captions []Caption
+
+// Format retorna o formato do arquivo de legendas a partir da sua extensão.
+func (c Caption) Format() string {
+	switch strings.ToLower(path.Ext(c.FilePath)) {
+	case ".srt":
+		return CaptionFormatSRT
+	case ".vtt":
+		return CaptionFormatWebVTT
+	}
+	return ""
+}
+
+func (c Caption) Validate() error {
+	if !captionLanguage.MatchString(c.Language) {
+		return fmt.Errorf("invalid caption language %q", c.Language)
+	}
+	if c.FilePath == "" {
+		return fmt.Errorf("caption file path is required for language %s", c.Language)
+	}
+	if c.Format() == "" {
+		return fmt.Errorf("unsupported caption file %q: expected .srt or .vtt", c.FilePath)
+	}
+	return nil
+}
+
+// Validate valida cada legenda e exige no máximo um arquivo por idioma.
+func (c Captions) Validate() error {
+	languages := map[string]bool{}
+	for _, caption := range c {
+		if err := caption.Validate(); err != nil {
+			return err
+		}
+		if languages[caption.Language] {
+			return fmt.Errorf("duplicate caption language %s", caption.Language)
+		}
+		languages[caption.Language] = true
+	}
+	return nil
+}
+
+func (c Captions) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (c *Captions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	}
+	return fmt.Errorf("cannot scan %T into Captions", value)
+}
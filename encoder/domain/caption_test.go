@@ -0,0 +1,42 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+func TestCaptionFormat(t *testing.T) {
+	require.Equal(t, domain.CaptionFormatSRT, domain.Caption{Language: "en", FilePath: "subs/en.SRT"}.Format())
+	require.Equal(t, domain.CaptionFormatWebVTT, domain.Caption{Language: "en", FilePath: "subs/en.vtt"}.Format())
+	require.Equal(t, "", domain.Caption{Language: "en", FilePath: "subs/en.txt"}.Format())
+}
+
+func TestVideoValidatesCaptions(t *testing.T) {
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.ResourceID = "a"
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	video.Captions = domain.Captions{
+		{Language: "pt-BR", FilePath: "subs/pt.srt"},
+		{Language: "en", FilePath: "subs/en.vtt"},
+	}
+	require.Nil(t, video.Validate())
+
+	video.Captions = domain.Captions{{Language: "Portuguese", FilePath: "subs/pt.srt"}}
+	require.Error(t, video.Validate())
+
+	video.Captions = domain.Captions{{Language: "pt", FilePath: "subs/pt.txt"}}
+	require.Error(t, video.Validate())
+
+	video.Captions = domain.Captions{
+		{Language: "pt", FilePath: "subs/pt.srt"},
+		{Language: "pt", FilePath: "subs/pt.vtt"},
+	}
+	require.Error(t, video.Validate())
+}
@@ -1,30 +1,73 @@
 package domain
 
 import (
+	"fmt"
+
 	"github.com/asaskevich/govalidator"
 	uuid "github.com/satori/go.uuid"
 	"time"
 )
 
+const (
+	AccessPolicyPublic        = "public"
+	AccessPolicyPrivate       = "private"
+	AccessPolicyBucketDefault = "bucket-default"
+)
+
+// Etapas do processamento registradas como checkpoints em Job.CompletedStages.
+const (
+	StageDownloaded = "downloaded"
+	StageProbed     = "probed"
+	StageTranscoded = "transcoded"
+	StageFragmented = "fragmented"
+	StageEncoded    = "encoded"
+	StageSprites    = "sprites"
+	StageThumbnails = "thumbnails"
+	StageUploaded   = "uploaded"
+)
+
+const (
+	PackagingDASH    = "dash"
+	PackagingHLS     = "hls"
+	PackagingDASHHLS = "dash+hls"
+)
+
 type Job struct {
-	ID               string    `json:"job_id" valid:"uuid" gorm:"type:uuid;primary_key"`
-	OutputBucketPath string    `json:"output-bucket-path" valid:"notnull"`
-	Status           string    `json:"status" valid:"notnull"`
-	Video            *Video    `json:"video" valid:"-"`
-	VideoID          string    `json:"-" valid:"-" gorm:"column:video_id;type:uuid;notnull"`
-	Error            string    `valid:"-"`
-	CreatedAt        time.Time `json:"createdAt" valid:"-"`
-	UpdatedAt        time.Time `json:"updatedAt" valid:"-"`
+	ID               string     `json:"job_id" valid:"uuid" gorm:"type:uuid;primary_key"`
+	OutputBucketPath string     `json:"output-bucket-path" valid:"notnull"`
+	Status           JobStatus  `json:"status" valid:"notnull"`
+	AccessPolicy     string     `json:"access_policy" valid:"in(public|private|bucket-default)"`
+	Packaging        string     `json:"packaging" valid:"in(dash|hls|dash+hls)"`
+	PresetName       string     `json:"preset" valid:"-"`
+	Preset           *Preset    `json:"-" valid:"-" gorm:"-"`
+	ManifestPath     string     `json:"manifest_path" valid:"-"`
+	MasterPlaylist   string     `json:"master_playlist" valid:"-"`
+	MediaPlaylists   StringList `json:"media_playlists" valid:"-" gorm:"type:text"`
+	Poster           string     `json:"poster" valid:"-"`
+	Thumbnails       StringList `json:"thumbnails" valid:"-" gorm:"type:text"`
+	SpriteTrack      string     `json:"sprite_track" valid:"-"`
+	KID              string     `json:"kid" valid:"-" gorm:"column:kid"`
+	CompletedStages  StringList `json:"completed_stages" valid:"-" gorm:"type:text"`
+	// RequestFingerprint identifica as opções do pedido que criou o job. Um job que falhou
+	// só é retomado por um pedido com as mesmas opções.
+	RequestFingerprint string    `json:"-" valid:"-"`
+	Video              *Video    `json:"video" valid:"-"`
+	VideoID            string    `json:"-" valid:"-" gorm:"column:video_id;type:uuid;notnull"`
+	Error              string    `valid:"-"`
+	CreatedAt          time.Time `json:"createdAt" valid:"-"`
+	UpdatedAt          time.Time `json:"updatedAt" valid:"-"`
 }
 
 func init() {
 	govalidator.SetFieldsRequiredByDefault(true)
 }
 
-func NewJob(output string, status string, video *Video) (*Job, error) {
+func NewJob(output string, status JobStatus, video *Video) (*Job, error) {
 	job := Job{
 		OutputBucketPath: output,
 		Status:           status,
+		AccessPolicy:     AccessPolicyBucketDefault,
+		Packaging:        PackagingDASH,
 		Video:            video,
 	}
 	job.prepare()
@@ -46,5 +89,25 @@ func (job *Job) Validate() error {
 	if err != nil {
 		return err
 	}
+	if !job.Status.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownJobStatus, job.Status)
+	}
 	return nil
 }
+
+// StageCompleted informa se a etapa já foi concluída em uma execução anterior do job.
+func (job *Job) StageCompleted(stage string) bool {
+	for _, completed := range job.CompletedStages {
+		if completed == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteStage registra a conclusão da etapa.
+func (job *Job) CompleteStage(stage string) {
+	if !job.StageCompleted(stage) {
+		job.CompletedStages = append(job.CompletedStages, stage)
+	}
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	uuid "github.com/satori/go.uuid"
+)
+
+// JobEvent registra uma mudança de status de um job. Duration é o tempo que o job passou
+// no status anterior, permitindo medir quanto durou cada etapa do processamento.
+type JobEvent struct {
+	ID         string        `json:"id" valid:"uuid" gorm:"type:uuid;primary_key"`
+	JobID      string        `json:"job_id" valid:"uuid" gorm:"column:job_id;type:uuid;notnull;index"`
+	FromStatus JobStatus     `json:"from_status" valid:"-"`
+	Status     JobStatus     `json:"status" valid:"notnull"`
+	WorkerID   int           `json:"worker_id" valid:"-"`
+	Duration   time.Duration `json:"duration" valid:"-"`
+	Error      string        `json:"error" valid:"-"`
+	CreatedAt  time.Time     `json:"created_at" valid:"-"`
+}
+
+func init() {
+	govalidator.SetFieldsRequiredByDefault(true)
+}
+
+func NewJobEvent(job *Job, from JobStatus, duration time.Duration, workerID int) (*JobEvent, error) {
+	event := JobEvent{
+		JobID:      job.ID,
+		FromStatus: from,
+		Status:     job.Status,
+		WorkerID:   workerID,
+		Duration:   duration,
+	}
+	if job.Status.Interrupted() {
+		event.Error = job.Error
+	}
+	event.prepare()
+	err := event.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (event *JobEvent) prepare() {
+	event.ID = uuid.NewV4().String()
+	event.CreatedAt = time.Now()
+}
+
+func (event *JobEvent) Validate() error {
+	_, err := govalidator.ValidateStruct(event)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// JobStatus é a etapa em que um job se encontra.
+type JobStatus string
+
+const (
+	JobStarting          JobStatus = "STARTING"
+	JobDownloading       JobStatus = "DOWNLOADING"
+	JobProbing           JobStatus = "PROBING"
+	JobTranscoding       JobStatus = "TRANSCODING"
+	JobFragmenting       JobStatus = "FRAGMENTING"
+	JobEncoding          JobStatus = "ENCODING"
+	JobGeneratingSprites JobStatus = "GENERATING_SPRITES"
+	JobThumbnailing      JobStatus = "THUMBNAILING"
+	JobUploading         JobStatus = "UPLOADING"
+	JobFinishing         JobStatus = "FINISHING"
+	JobCompleted         JobStatus = "COMPLETED"
+	JobFailed            JobStatus = "FAILED"
+	JobTimedOut          JobStatus = "TIMED_OUT"
+	JobCancelled         JobStatus = "CANCELLED"
+)
+
+var (
+	ErrUnknownJobStatus  = errors.New("unknown job status")
+	ErrIllegalTransition = errors.New("illegal job status transition")
+)
+
+// jobTransitions lista, para cada status, os status seguintes permitidos. Toda etapa em
+// andamento pode falhar, estourar o tempo limite ou ser cancelada. Um job que falhou ou
+// estourou o tempo limite pode ser reiniciado ou cancelado enquanto aguarda; um job
+// cancelado não volta a rodar.
+var jobTransitions = map[JobStatus][]JobStatus{
+	JobStarting:          {JobDownloading, JobFailed, JobTimedOut, JobCancelled},
+	JobDownloading:       {JobProbing, JobFailed, JobTimedOut, JobCancelled},
+	JobProbing:           {JobTranscoding, JobFailed, JobTimedOut, JobCancelled},
+	JobTranscoding:       {JobFragmenting, JobFailed, JobTimedOut, JobCancelled},
+	JobFragmenting:       {JobEncoding, JobFailed, JobTimedOut, JobCancelled},
+	JobEncoding:          {JobGeneratingSprites, JobThumbnailing, JobFailed, JobTimedOut, JobCancelled},
+	JobGeneratingSprites: {JobThumbnailing, JobFailed, JobTimedOut, JobCancelled},
+	JobThumbnailing:      {JobUploading, JobFailed, JobTimedOut, JobCancelled},
+	JobUploading:         {JobFinishing, JobFailed, JobTimedOut, JobCancelled},
+	JobFinishing:         {JobCompleted, JobFailed, JobTimedOut, JobCancelled},
+	JobCompleted:         {},
+	JobFailed:            {JobStarting, JobCancelled},
+	JobTimedOut:          {JobStarting, JobCancelled},
+	JobCancelled:         {},
+}
+
+// Valid informa se o status é conhecido.
+func (s JobStatus) Valid() bool {
+	_, ok := jobTransitions[s]
+	return ok
+}
+
+// Terminal informa se o job não pode mais avançar a partir do status.
+func (s JobStatus) Terminal() bool {
+	return s == JobCompleted || s.Interrupted()
+}
+
+// Interrupted informa se o job parou sem concluir: por falha, tempo limite ou cancelamento.
+func (s JobStatus) Interrupted() bool {
+	return s == JobFailed || s == JobTimedOut || s == JobCancelled
+}
+
+// CanTransitionTo informa se o job pode passar do status atual para next. Permanecer no
+// mesmo status é sempre permitido.
+func (s JobStatus) CanTransitionTo(next JobStatus) bool {
+	if s == next {
+		return s.Valid()
+	}
+	for _, allowed := range jobTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition retorna ErrUnknownJobStatus ou ErrIllegalTransition se o job não
+// puder passar de from para to.
+func ValidateTransition(from JobStatus, to JobStatus) error {
+	if !from.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownJobStatus, from)
+	}
+	if !to.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownJobStatus, to)
+	}
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	return nil
+}
+
+// TransitionTo muda o status do job, recusando transições ilegais.
+func (job *Job) TransitionTo(status JobStatus) error {
+	if err := ValidateTransition(job.Status, status); err != nil {
+		return err
+	}
+	job.Status = status
+	return nil
+}
@@ -0,0 +1,71 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+func TestJobStatusTransitions(t *testing.T) {
+	require.True(t, domain.JobStarting.CanTransitionTo(domain.JobDownloading))
+	require.True(t, domain.JobEncoding.CanTransitionTo(domain.JobThumbnailing))
+	require.True(t, domain.JobEncoding.CanTransitionTo(domain.JobGeneratingSprites))
+	require.True(t, domain.JobUploading.CanTransitionTo(domain.JobFailed))
+	require.True(t, domain.JobFailed.CanTransitionTo(domain.JobStarting))
+	require.True(t, domain.JobEncoding.CanTransitionTo(domain.JobEncoding))
+
+	require.False(t, domain.JobCompleted.CanTransitionTo(domain.JobDownloading))
+	require.False(t, domain.JobCompleted.CanTransitionTo(domain.JobFailed))
+	require.False(t, domain.JobDownloading.CanTransitionTo(domain.JobUploading))
+	require.False(t, domain.JobFailed.CanTransitionTo(domain.JobCompleted))
+
+	require.True(t, domain.JobCompleted.Terminal())
+	require.False(t, domain.JobUploading.Terminal())
+}
+
+func TestJobTransitionTo(t *testing.T) {
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	job, err := domain.NewJob("path", domain.JobStarting, video)
+	require.Nil(t, err)
+
+	require.Nil(t, job.TransitionTo(domain.JobDownloading))
+	require.Equal(t, domain.JobDownloading, job.Status)
+
+	err = job.TransitionTo(domain.JobCompleted)
+	require.ErrorIs(t, err, domain.ErrIllegalTransition)
+	require.Equal(t, domain.JobDownloading, job.Status)
+
+	err = job.TransitionTo("PAUSED")
+	require.ErrorIs(t, err, domain.ErrUnknownJobStatus)
+}
+
+func TestJobValidatesStatus(t *testing.T) {
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	_, err := domain.NewJob("path", "converted", video)
+	require.ErrorIs(t, err, domain.ErrUnknownJobStatus)
+}
+
+func TestJobStatusInterruptions(t *testing.T) {
+	require.True(t, domain.JobTranscoding.CanTransitionTo(domain.JobTimedOut))
+	require.True(t, domain.JobUploading.CanTransitionTo(domain.JobCancelled))
+	require.True(t, domain.JobTimedOut.CanTransitionTo(domain.JobStarting))
+	require.True(t, domain.JobFailed.CanTransitionTo(domain.JobCancelled))
+	require.False(t, domain.JobCancelled.CanTransitionTo(domain.JobStarting))
+	require.False(t, domain.JobCompleted.CanTransitionTo(domain.JobCancelled))
+	require.False(t, domain.JobCancelled.CanTransitionTo(domain.JobDownloading))
+
+	require.True(t, domain.JobTimedOut.Interrupted())
+	require.True(t, domain.JobCancelled.Terminal())
+	require.False(t, domain.JobCompleted.Interrupted())
+}
@@ -14,7 +14,41 @@ func TestNewJob(t *testing.T) {
 	video.FilePath = "path"
 	video.CreatedAt = time.Now()
 
-	job, err := domain.NewJob("path", "converted", video)
+	job, err := domain.NewJob("path", domain.JobStarting, video)
 	require.NotNil(t, job)
 	require.Nil(t, err)
 }
+
+func TestJobAccessPolicyValidation(t *testing.T) {
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	job, err := domain.NewJob("path", domain.JobStarting, video)
+	require.Nil(t, err)
+	require.Equal(t, domain.AccessPolicyBucketDefault, job.AccessPolicy)
+
+	job.AccessPolicy = domain.AccessPolicyPrivate
+	require.Nil(t, job.Validate())
+
+	job.AccessPolicy = "world-writable"
+	require.Error(t, job.Validate())
+}
+
+func TestJobPackagingValidation(t *testing.T) {
+	video := domain.NewVideo()
+	video.ID = uuid.NewV4().String()
+	video.FilePath = "path"
+	video.CreatedAt = time.Now()
+
+	job, err := domain.NewJob("path", domain.JobStarting, video)
+	require.Nil(t, err)
+	require.Equal(t, domain.PackagingDASH, job.Packaging)
+
+	job.Packaging = domain.PackagingDASHHLS
+	require.Nil(t, job.Validate())
+
+	job.Packaging = "smooth"
+	require.Error(t, job.Validate())
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	EncryptionNone = "none"
+	EncryptionCENC = "cenc"
+	EncryptionCBCS = "cbcs"
+)
+
+type Preset struct {
+	ID              string     `json:"id" valid:"uuid" gorm:"type:uuid;primary_key"`
+	Name            string     `json:"name" valid:"notnull" gorm:"unique_index"`
+	VideoCodec      string     `json:"video_codec" valid:"in(libx264|libx265)"`
+	AudioCodec      string     `json:"audio_codec" valid:"in(aac)"`
+	Renditions      Renditions `json:"renditions" valid:"-" gorm:"type:text"`
+	Packaging       string     `json:"packaging" valid:"in(dash|hls|dash+hls)"`
+	SegmentDuration int        `json:"segment_duration" valid:"range(1|30)"`
+	Encryption      string     `json:"encryption" valid:"in(none|cenc|cbcs)"`
+	CreatedAt       time.Time  `json:"createdAt" valid:"-"`
+	UpdatedAt       time.Time  `json:"updatedAt" valid:"-"`
+}
+
+func init() {
+	govalidator.SetFieldsRequiredByDefault(true)
+}
+
+// NewPreset cria um preset H.264/AAC empacotado em DASH, com segmentos de 2 segundos e
+// sem criptografia, para a escada de renditions informada.
+func NewPreset(name string, renditions Renditions) (*Preset, error) {
+	preset := Preset{
+		Name:            name,
+		VideoCodec:      "libx264",
+		AudioCodec:      "aac",
+		Renditions:      renditions,
+		Packaging:       PackagingDASH,
+		SegmentDuration: 2,
+		Encryption:      EncryptionNone,
+	}
+	preset.prepare()
+	err := preset.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+func (preset *Preset) prepare() {
+	preset.ID = uuid.NewV4().String()
+	preset.CreatedAt = time.Now()
+	preset.UpdatedAt = time.Now()
+}
+
+func (preset *Preset) Validate() error {
+	_, err := govalidator.ValidateStruct(preset)
+	if err != nil {
+		return err
+	}
+
+	if len(preset.Renditions) == 0 {
+		return fmt.Errorf("renditions: preset %s has no renditions", preset.Name)
+	}
+	names := map[string]bool{}
+	for _, rendition := range preset.Renditions {
+		err = rendition.Validate()
+		if err != nil {
+			return err
+		}
+		// Cada rendition grava arquivos com o seu nome; nomes repetidos se sobrescreveriam.
+		if names[rendition.Name] {
+			return fmt.Errorf("renditions: preset %s has more than one rendition named %s", preset.Name, rendition.Name)
+		}
+		names[rendition.Name] = true
+	}
+
+	return nil
+}
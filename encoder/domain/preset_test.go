@@ -0,0 +1,47 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+func TestNewPreset(t *testing.T) {
+	preset, err := domain.NewPreset("web", domain.DefaultRenditions())
+	require.Nil(t, err)
+	require.NotEmpty(t, preset.ID)
+	require.Equal(t, domain.PackagingDASH, preset.Packaging)
+	require.Equal(t, domain.EncryptionNone, preset.Encryption)
+}
+
+func TestPresetValidation(t *testing.T) {
+	_, err := domain.NewPreset("", domain.DefaultRenditions())
+	require.Error(t, err)
+
+	_, err = domain.NewPreset("web", nil)
+	require.Error(t, err)
+
+	preset, err := domain.NewPreset("web", domain.DefaultRenditions())
+	require.Nil(t, err)
+
+	preset.VideoCodec = "mpeg2video"
+	require.Error(t, preset.Validate())
+
+	preset.VideoCodec = "libx265"
+	preset.SegmentDuration = 0
+	require.Error(t, preset.Validate())
+
+	preset.SegmentDuration = 4
+	preset.Encryption = "aes-128"
+	require.Error(t, preset.Validate())
+
+	preset.Encryption = domain.EncryptionCBCS
+	preset.Renditions[0].VideoBitrate = 0
+	require.Error(t, preset.Validate())
+
+	preset.Renditions = domain.DefaultRenditions()
+	require.Nil(t, preset.Validate())
+	preset.Renditions[1].Name = preset.Renditions[0].Name
+	require.ErrorContains(t, preset.Validate(), "more than one rendition named")
+}
@@ -0,0 +1,166 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rendition é um nível de qualidade da escada de bitrates adaptativos. Os bitrates
+// estão em kbps. Height é o lado menor do vídeo gerado, de modo que a mesma escada atenda
+// vídeos horizontais e verticais. Width zero mantém a proporção do vídeo de origem; com
+// Width, o vídeo é reduzido para caber em WidthxHeight e completado com bordas.
+type Rendition struct {
+	Name         string `json:"name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	VideoBitrate int    `json:"video_bitrate"`
+	AudioBitrate int    `json:"audio_bitrate"`
+}
+
+// Renditions é uma escada de renditions persistida como JSON em uma única coluna.
+type Renditions []Rendition
+
+// DefaultRenditions retorna a escada padrão: 1080p, 720p, 480p e 360p.
+func DefaultRenditions() Renditions {
+	return Renditions{
+		{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+		{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+		{Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+		{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	}
+}
+
+// ParseRenditions lê uma escada no formato "nome:LARGURAxALTURA:videokbps:audiokbps",
+// com as renditions separadas por vírgula. Ex.: "720p:1280x720:2800:128,360p:640x360:800:96".
+// Uma largura 0, como em "720p:0x720:2800:128", mantém a proporção do vídeo de origem.
+func ParseRenditions(s string) (Renditions, error) {
+	var renditions Renditions
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		fields := strings.Split(item, ":")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid rendition %q: expected name:WIDTHxHEIGHT:videokbps:audiokbps", item)
+		}
+
+		var width, height int
+		if _, err := fmt.Sscanf(fields[1], "%dx%d", &width, &height); err != nil {
+			return nil, fmt.Errorf("invalid rendition %q: bad resolution %q", item, fields[1])
+		}
+
+		videoBitrate, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rendition %q: bad video bitrate %q", item, fields[2])
+		}
+
+		audioBitrate, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rendition %q: bad audio bitrate %q", item, fields[3])
+		}
+
+		rendition := Rendition{
+			Name:         fields[0],
+			Width:        width,
+			Height:       height,
+			VideoBitrate: videoBitrate,
+			AudioBitrate: audioBitrate,
+		}
+		if err = rendition.Validate(); err != nil {
+			return nil, err
+		}
+
+		renditions = append(renditions, rendition)
+	}
+
+	return renditions, nil
+}
+
+func (r Rendition) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rendition name is required")
+	}
+	if strings.ContainsAny(r.Name, `/\ `) {
+		return fmt.Errorf("invalid rendition name %q", r.Name)
+	}
+	if r.Height <= 0 || r.Width < 0 {
+		return fmt.Errorf("invalid resolution for rendition %s", r.Name)
+	}
+	if r.VideoBitrate <= 0 || r.AudioBitrate <= 0 {
+		return fmt.Errorf("invalid bitrate for rendition %s", r.Name)
+	}
+	return nil
+}
+
+// ScaleFilter retorna o filtro de escala do ffmpeg que gera a rendition a partir de um
+// vídeo de sourceWidth x sourceHeight, sem distorcê-lo. Sem Width, o lado menor do vídeo
+// passa a medir Height; com Width, o vídeo é reduzido para caber em WidthxHeight e
+// centralizado com bordas.
+func (r Rendition) ScaleFilter(sourceWidth int, sourceHeight int) string {
+	if r.Width > 0 {
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+			r.Width, r.Height, r.Width, r.Height)
+	}
+	if sourceWidth > 0 && sourceWidth < sourceHeight {
+		return fmt.Sprintf("scale=%d:-2", r.Height)
+	}
+	return fmt.Sprintf("scale=-2:%d", r.Height)
+}
+
+// For retorna as renditions que não excedem o lado menor de um vídeo de width x height,
+// mantendo ao menos a menor delas. Sem as dimensões do vídeo, retorna todas.
+func (r Renditions) For(width int, height int) Renditions {
+	shortSide := height
+	if width > 0 && width < height {
+		shortSide = width
+	}
+	if shortSide == 0 || len(r) == 0 {
+		return r
+	}
+
+	var renditions Renditions
+	lowest := r[0]
+	for _, rendition := range r {
+		if rendition.Height <= shortSide {
+			renditions = append(renditions, rendition)
+		}
+		if rendition.Height < lowest.Height {
+			lowest = rendition
+		}
+	}
+
+	if len(renditions) == 0 {
+		renditions = Renditions{lowest}
+	}
+	return renditions
+}
+
+func (r Renditions) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (r *Renditions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case []byte:
+		return json.Unmarshal(v, r)
+	}
+	return fmt.Errorf("cannot scan %T into Renditions", value)
+}
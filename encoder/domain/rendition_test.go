@@ -0,0 +1,57 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+func TestParseRenditions(t *testing.T) {
+	renditions, err := domain.ParseRenditions("720p:1280x720:2800:128, 360p:640x360:800:96")
+	require.Nil(t, err)
+	require.Equal(t, domain.Renditions{
+		{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+		{Name: "360p", Width: 640, Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	}, renditions)
+
+	renditions, err = domain.ParseRenditions("")
+	require.Nil(t, err)
+	require.Empty(t, renditions)
+
+	_, err = domain.ParseRenditions("720p:1280x720:2800")
+	require.Error(t, err)
+
+	_, err = domain.ParseRenditions("720p:1280:2800:128")
+	require.Error(t, err)
+
+	_, err = domain.ParseRenditions("720p:1280x720:fast:128")
+	require.Error(t, err)
+}
+
+func TestParseRenditionsKeepingAspectRatio(t *testing.T) {
+	renditions, err := domain.ParseRenditions("720p:0x720:2800:128")
+	require.Nil(t, err)
+	require.Equal(t, 0, renditions[0].Width)
+	require.Equal(t, 720, renditions[0].Height)
+}
+
+func TestRenditionScaleFilter(t *testing.T) {
+	rendition := domain.Rendition{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128}
+	require.Equal(t, "scale=-2:720", rendition.ScaleFilter(1440, 1080))
+	require.Equal(t, "scale=-2:720", rendition.ScaleFilter(0, 0))
+	require.Equal(t, "scale=720:-2", rendition.ScaleFilter(1080, 1920))
+
+	rendition.Width = 1280
+	require.Equal(t, "scale=1280:720:force_original_aspect_ratio=decrease:force_divisible_by=2,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1", rendition.ScaleFilter(1440, 1080))
+}
+
+func TestRenditionsFor(t *testing.T) {
+	renditions := domain.DefaultRenditions()
+
+	require.Equal(t, renditions, renditions.For(0, 0))
+	require.Equal(t, renditions[1:], renditions.For(1280, 720))
+	// Um vídeo vertical de 720x1280 recebe as mesmas renditions que um horizontal de 1280x720.
+	require.Equal(t, renditions[1:], renditions.For(720, 1280))
+	require.Equal(t, renditions[3:], renditions.For(320, 240))
+}
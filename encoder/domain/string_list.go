@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList é uma lista de strings persistida como JSON em uma única coluna.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	case []byte:
+		return json.Unmarshal(v, l)
+	}
+	return fmt.Errorf("cannot scan %T into StringList", value)
+}
@@ -6,11 +6,21 @@ import (
 )
 
 type Video struct {
-	ID         string    `json:"encoded_video_folder" valid:"uuid"`
-	ResourceID string    `json:"resource_id" valid:"notnull"`
-	FilePath   string    `json:"file_path" valid:"notnull"`
-	CreatedAt  time.Time `json:"-" valid:"-"`
-	Jobs       []*Job    `json:"-" valid:"-" gorm:"ForeignKey:VideoID"`
+	ID            string    `json:"encoded_video_folder" valid:"uuid"`
+	ResourceID    string    `json:"resource_id" valid:"notnull"`
+	FilePath      string    `json:"file_path" valid:"notnull"`
+	Duration      float64   `json:"duration" valid:"-"`
+	Width         int       `json:"width" valid:"-"`
+	Height        int       `json:"height" valid:"-"`
+	FrameRate     float64   `json:"frame_rate" valid:"-"`
+	VideoCodec    string    `json:"video_codec" valid:"-"`
+	AudioCodec    string    `json:"audio_codec" valid:"-"`
+	ChannelLayout string    `json:"channel_layout" valid:"-"`
+	Container     string    `json:"container" valid:"-"`
+	Bitrate       int64     `json:"bitrate" valid:"-"`
+	Captions      Captions  `json:"captions" valid:"-" gorm:"type:text"`
+	CreatedAt     time.Time `json:"-" valid:"-"`
+	Jobs          []*Job    `json:"-" valid:"-" gorm:"ForeignKey:VideoID"`
 }
 
 func init() {
@@ -26,5 +36,5 @@ func (video *Video) Validate() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return video.Captions.Validate()
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/streadway/amqp"
+	"github.com/zemartins81/encoderVideoGolang/application/services"
+	"github.com/zemartins81/encoderVideoGolang/framework/database"
+	"github.com/zemartins81/encoderVideoGolang/framework/queue"
+)
+
+var db database.Database
+
+func init() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("no .env file found, using the environment")
+	}
+
+	autoMigrateDb, err := strconv.ParseBool(os.Getenv("AUTO_MIGRATE_DB"))
+	if err != nil {
+		log.Fatalf("Error parsing boolean env var AUTO_MIGRATE_DB")
+	}
+
+	debug, err := strconv.ParseBool(os.Getenv("DEBUG"))
+	if err != nil {
+		log.Fatalf("Error parsing boolean env var DEBUG")
+	}
+
+	db.AutoMigrateDb = autoMigrateDb
+	db.Debug = debug
+	db.DsnTest = os.Getenv("DSN_TEST")
+	db.Dsn = os.Getenv("DSN")
+	db.DbTypeTest = os.Getenv("DB_TYPE_TEST")
+	db.DbType = os.Getenv("DB_TYPE")
+	db.Env = os.Getenv("ENV")
+}
+
+func main() {
+	messageChannel := make(chan amqp.Delivery)
+	jobReturnChannel := make(chan services.JobWorkerResult)
+
+	dbConnection, err := db.Connect()
+	if err != nil {
+		log.Fatalf("error connecting to DB: %v", err)
+	}
+	defer dbConnection.Close()
+
+	rabbitMQ := queue.NewRabbitMQ()
+	_, err = rabbitMQ.Connect()
+	if err != nil {
+		log.Fatalf("error connecting to RabbitMQ: %v", err)
+	}
+	defer rabbitMQ.Close()
+
+	jobManager := services.NewJobManager(dbConnection, rabbitMQ, jobReturnChannel, messageChannel)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Println("shutting down, waiting for running jobs")
+		err := jobManager.Shutdown(shutdownTimeout())
+		if err != nil {
+			log.Printf("error stopping the consumer: %v", err)
+		}
+	}()
+
+	err = jobManager.Start()
+	if err != nil {
+		log.Printf("error starting job manager: %v", err)
+	}
+}
+
+// shutdownTimeout retorna por quanto tempo os jobs em andamento podem terminar depois de
+// SIGTERM, lido de SHUTDOWN_TIMEOUT. Deve ser menor que o terminationGracePeriodSeconds
+// do pod.
+func shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		return 25 * time.Second
+	}
+	return timeout
+}
@@ -55,8 +55,9 @@ func (d *Database) Connect() (*gorm.DB, error) {
 	}
 
 	if d.AutoMigrateDb {
-		d.DB.AutoMigrate(&domain.Video{}, &domain.Job{})
+		d.DB.AutoMigrate(&domain.Video{}, &domain.Job{}, &domain.Preset{}, &domain.JobEvent{})
 		d.DB.Model(domain.Job{}).AddForeignKey("video_id", "videos (id)", "CASCADE", "CASCADE")
+		d.DB.Model(domain.JobEvent{}).AddForeignKey("job_id", "jobs (id)", "CASCADE", "CASCADE")
 	}
 
 	return d.DB, nil
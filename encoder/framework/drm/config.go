@@ -0,0 +1,30 @@
+package drm
+
+import (
+	"fmt"
+	"os"
+)
+
+// NewKeyProvider cria o KeyProvider indicado em KEY_PROVIDER: "static", com a chave
+// DRM_KEY_ID/DRM_KEY, ou "file", com as chaves em DRM_KEY_FILE. Sem KEY_PROVIDER,
+// retorna nil e os jobs não podem usar presets com criptografia.
+func NewKeyProvider() (KeyProvider, error) {
+	switch driver := os.Getenv("KEY_PROVIDER"); driver {
+	case "":
+		return nil, nil
+	case "static":
+		provider, err := NewStaticKeyProvider(os.Getenv("DRM_KEY_ID"), os.Getenv("DRM_KEY"))
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case "file":
+		path := os.Getenv("DRM_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("DRM_KEY_FILE is required by the file key provider")
+		}
+		return NewFileKeyProvider(path), nil
+	default:
+		return nil, fmt.Errorf("unknown key provider: %s", driver)
+	}
+}
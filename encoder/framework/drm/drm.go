@@ -0,0 +1,40 @@
+package drm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// ContentKey é um par KID/chave AES-128 da Common Encryption, codificado em hexadecimal.
+type ContentKey struct {
+	KID string `json:"kid"`
+	Key string `json:"key"`
+}
+
+// KeyProvider fornece a chave de conteúdo usada para criptografar os arquivos de um job.
+// O KID retornado é registrado no job para que o servidor de licenças encontre a chave.
+type KeyProvider interface {
+	Key(ctx context.Context, jobID string) (*ContentKey, error)
+}
+
+// NewContentKey gera um par KID/chave aleatório.
+func NewContentKey() (*ContentKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &ContentKey{KID: hex.EncodeToString(b[:16]), Key: hex.EncodeToString(b[16:])}, nil
+}
+
+// Validate exige KID e chave com 16 bytes em hexadecimal.
+func (k *ContentKey) Validate() error {
+	for name, value := range map[string]string{"kid": k.KID, "key": k.Key} {
+		b, err := hex.DecodeString(value)
+		if err != nil || len(b) != 16 {
+			return fmt.Errorf("invalid content key: %s must be 32 hex characters", name)
+		}
+	}
+	return nil
+}
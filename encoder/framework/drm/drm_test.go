@@ -0,0 +1,78 @@
+package drm_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/framework/drm"
+)
+
+const (
+	testKID = "0123456789abcdef0123456789abcdef"
+	testKey = "fedcba9876543210fedcba9876543210"
+)
+
+func TestStaticKeyProvider(t *testing.T) {
+	provider, err := drm.NewStaticKeyProvider(testKID, testKey)
+	require.Nil(t, err)
+
+	key, err := provider.Key(context.Background(), "job")
+	require.Nil(t, err)
+	require.Equal(t, testKID, key.KID)
+	require.Equal(t, testKey, key.Key)
+
+	_, err = drm.NewStaticKeyProvider("abc", testKey)
+	require.Error(t, err)
+}
+
+func TestFileKeyProviderPersistsKeysPerJob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ctx := context.Background()
+
+	first, err := drm.NewFileKeyProvider(path).Key(ctx, "job-1")
+	require.Nil(t, err)
+	require.Nil(t, first.Validate())
+
+	other, err := drm.NewFileKeyProvider(path).Key(ctx, "job-2")
+	require.Nil(t, err)
+	require.NotEqual(t, first.KID, other.KID)
+
+	again, err := drm.NewFileKeyProvider(path).Key(ctx, "job-1")
+	require.Nil(t, err)
+	require.Equal(t, first, again)
+
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestNewKeyProvider(t *testing.T) {
+	t.Setenv("KEY_PROVIDER", "")
+	provider, err := drm.NewKeyProvider()
+	require.Nil(t, err)
+	require.Nil(t, provider)
+
+	t.Setenv("KEY_PROVIDER", "static")
+	t.Setenv("DRM_KEY_ID", testKID)
+	t.Setenv("DRM_KEY", testKey)
+	provider, err = drm.NewKeyProvider()
+	require.Nil(t, err)
+	require.IsType(t, &drm.StaticKeyProvider{}, provider)
+
+	t.Setenv("DRM_KEY", "")
+	_, err = drm.NewKeyProvider()
+	require.Error(t, err)
+
+	t.Setenv("KEY_PROVIDER", "file")
+	t.Setenv("DRM_KEY_FILE", "/tmp/keys.json")
+	provider, err = drm.NewKeyProvider()
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/keys.json", provider.(*drm.FileKeyProvider).Path)
+
+	t.Setenv("KEY_PROVIDER", "kms")
+	_, err = drm.NewKeyProvider()
+	require.Error(t, err)
+}
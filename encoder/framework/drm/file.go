@@ -0,0 +1,96 @@
+package drm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileKeyProvider guarda as chaves em um arquivo JSON local, indexado pelo ID do job.
+// Jobs sem chave recebem um par aleatório, gravado no arquivo antes de ser retornado.
+// Destina-se a desenvolvimento.
+type FileKeyProvider struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{Path: path}
+}
+
+func (p *FileKeyProvider) Key(ctx context.Context, jobID string) (*ContentKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := keys[jobID]; ok {
+		if err = key.Validate(); err != nil {
+			return nil, err
+		}
+		return &key, nil
+	}
+
+	key, err := NewContentKey()
+	if err != nil {
+		return nil, err
+	}
+	keys[jobID] = *key
+
+	if err = p.save(keys); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (p *FileKeyProvider) load() (map[string]ContentKey, error) {
+	keys := map[string]ContentKey{}
+
+	b, err := os.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// save grava as chaves em um arquivo temporário e o renomeia, para não corromper o
+// arquivo existente em caso de falha.
+func (p *FileKeyProvider) save(keys map[string]ContentKey) error {
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.Path), filepath.Base(p.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p.Path)
+}
@@ -0,0 +1,21 @@
+package drm
+
+import "context"
+
+// StaticKeyProvider usa a mesma chave em todos os jobs. Destina-se a desenvolvimento.
+type StaticKeyProvider struct {
+	ContentKey ContentKey
+}
+
+func NewStaticKeyProvider(kid string, key string) (*StaticKeyProvider, error) {
+	provider := &StaticKeyProvider{ContentKey: ContentKey{KID: kid, Key: key}}
+	if err := provider.ContentKey.Validate(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+func (p *StaticKeyProvider) Key(ctx context.Context, jobID string) (*ContentKey, error) {
+	key := p.ContentKey
+	return &key, nil
+}
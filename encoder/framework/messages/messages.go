@@ -0,0 +1,157 @@
+// Package messages define as mensagens trocadas com o encoder pelo RabbitMQ: os pedidos
+// de processamento consumidos da fila e os resultados publicados ao fim de cada job. As
+// mensagens são versionadas e validadas contra os JSON schemas em schemas/.
+package messages
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Version é a versão atual das mensagens.
+const Version = 1
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+var (
+	jobRequestSchemas = map[int]*gojsonschema.Schema{
+		1: mustLoadSchema("schemas/job_request.v1.json"),
+	}
+	jobResultSchemas = map[int]*gojsonschema.Schema{
+		1: mustLoadSchema("schemas/job_result.v1.json"),
+	}
+)
+
+// ErrUnsupportedVersion é retornado para mensagens de uma versão desconhecida.
+var ErrUnsupportedVersion = errors.New("unsupported message version")
+
+func mustLoadSchema(name string) *gojsonschema.Schema {
+	content, err := schemaFiles.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(content))
+	if err != nil {
+		panic(fmt.Sprintf("invalid schema %s: %v", name, err))
+	}
+	return schema
+}
+
+// FieldError é um erro de validação de um campo da mensagem. Field é o caminho do campo,
+// como "captions.0.language", ou vazio quando o erro é da mensagem como um todo.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reúne os erros de validação de uma mensagem.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		if fieldError.Field == "" {
+			messages = append(messages, fieldError.Message)
+			continue
+		}
+		messages = append(messages, fieldError.Field+": "+fieldError.Message)
+	}
+	return "invalid message: " + strings.Join(messages, "; ")
+}
+
+// FieldErrors extrai de err os erros por campo, de uma validação de schema ou do
+// govalidator. Retorna nil para os demais erros.
+func FieldErrors(err error) []FieldError {
+	var validationError *ValidationError
+	if errors.As(err, &validationError) {
+		return validationError.Errors
+	}
+
+	var validatorErrors govalidator.Errors
+	if errors.As(err, &validatorErrors) {
+		var fieldErrors []FieldError
+		for _, validatorError := range validatorErrors.Errors() {
+			var fieldError govalidator.Error
+			if errors.As(validatorError, &fieldError) {
+				fieldErrors = append(fieldErrors, FieldError{Field: fieldError.Name, Message: fieldError.Err.Error()})
+				continue
+			}
+			fieldErrors = append(fieldErrors, FieldError{Message: validatorError.Error()})
+		}
+		return fieldErrors
+	}
+
+	return nil
+}
+
+// validate valida document contra o schema da versão informada.
+func validate(schemas map[int]*gojsonschema.Schema, version int, document []byte) error {
+	schema, ok := schemas[version]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return &ValidationError{Errors: []FieldError{{Message: err.Error()}}}
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	validationError := &ValidationError{}
+	for _, resultError := range result.Errors() {
+		validationError.Errors = append(validationError.Errors, FieldError{
+			Field:   fieldPath(resultError),
+			Message: resultError.Description(),
+		})
+	}
+	return validationError
+}
+
+// fieldPath retorna o caminho do campo com erro. Nos campos obrigatórios ausentes o
+// gojsonschema aponta o objeto pai, então o nome do campo é acrescentado.
+func fieldPath(resultError gojsonschema.ResultError) string {
+	field := resultError.Field()
+	if field == gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+		field = ""
+	}
+
+	if property, ok := resultError.Details()["property"].(string); ok && resultError.Type() == "required" {
+		if field == "" {
+			return property
+		}
+		return field + "." + property
+	}
+	return field
+}
+
+// version lê o campo version de document. Mensagens sem versão, publicadas antes do
+// versionamento, são tratadas como da versão 1.
+func version(document []byte) (int, error) {
+	var envelope struct {
+		Version *json.Number `json:"version"`
+	}
+	err := json.Unmarshal(document, &envelope)
+	if err != nil {
+		return 0, &ValidationError{Errors: []FieldError{{Message: "malformed JSON: " + err.Error()}}}
+	}
+	if envelope.Version == nil {
+		return 1, nil
+	}
+
+	value, err := envelope.Version.Int64()
+	if err != nil {
+		return 0, &ValidationError{Errors: []FieldError{{Field: "version", Message: "must be an integer"}}}
+	}
+	return int(value), nil
+}
@@ -0,0 +1,125 @@
+package messages_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/domain"
+	"github.com/zemartins81/encoderVideoGolang/framework/messages"
+)
+
+func TestParseLegacyJobRequest(t *testing.T) {
+	request, err := messages.ParseJobRequest([]byte(`{"resource_id": "resource", "file_path": "emilly.mp4"}`))
+	require.Nil(t, err)
+	require.Equal(t, 1, request.Version)
+
+	video := request.Video()
+	require.Equal(t, "resource", video.ResourceID)
+	require.Equal(t, "emilly.mp4", video.FilePath)
+}
+
+func TestParseJobRequest(t *testing.T) {
+	request, err := messages.ParseJobRequest([]byte(`{
+		"version": 1,
+		"resource_id": "resource",
+		"file_path": "emilly.mp4",
+		"preset": "web-hd",
+		"packaging": "dash+hls",
+		"access_policy": "private",
+		"captions": [{"language": "pt-BR", "file_path": "emilly.pt-BR.srt"}]
+	}`))
+	require.Nil(t, err)
+	require.Equal(t, "web-hd", request.Preset)
+	require.Equal(t, domain.PackagingDASHHLS, request.Packaging)
+	require.Equal(t, domain.AccessPolicyPrivate, request.AccessPolicy)
+	require.Equal(t, domain.Captions{{Language: "pt-BR", FilePath: "emilly.pt-BR.srt"}}, request.Video().Captions)
+}
+
+func TestParseJobRequestFieldErrors(t *testing.T) {
+	_, err := messages.ParseJobRequest([]byte(`{
+		"resource_id": "resource",
+		"packaging": "smooth",
+		"captions": [{"language": "Portuguese", "file_path": "emilly.srt"}]
+	}`))
+
+	var validationError *messages.ValidationError
+	require.ErrorAs(t, err, &validationError)
+
+	fields := map[string]bool{}
+	for _, fieldError := range messages.FieldErrors(err) {
+		require.NotEmpty(t, fieldError.Message)
+		fields[fieldError.Field] = true
+	}
+	require.Equal(t, map[string]bool{"file_path": true, "packaging": true, "captions.0.language": true}, fields)
+}
+
+func TestParseJobRequestVersion(t *testing.T) {
+	_, err := messages.ParseJobRequest([]byte(`{"version": 2, "resource_id": "resource", "file_path": "emilly.mp4"}`))
+	require.ErrorIs(t, err, messages.ErrUnsupportedVersion)
+
+	_, err = messages.ParseJobRequest([]byte(`{"version": "1", "resource_id": "resource", "file_path": "emilly.mp4"}`))
+	require.Error(t, err)
+
+	_, err = messages.ParseJobRequest([]byte(`{"resource_id": `))
+	require.NotEmpty(t, messages.FieldErrors(err))
+}
+
+func TestDomainFieldErrors(t *testing.T) {
+	video := domain.NewVideo()
+	video.ResourceID = "resource"
+	video.FilePath = "emilly.mp4"
+
+	fieldErrors := messages.FieldErrors(video.Validate())
+	require.Len(t, fieldErrors, 1)
+	require.NotEmpty(t, fieldErrors[0].Field)
+
+	require.Nil(t, messages.FieldErrors(errors.New("connection reset")))
+}
+
+func TestJobResultValidate(t *testing.T) {
+	video := domain.NewVideo()
+	video.ResourceID = "resource"
+	video.FilePath = "emilly.mp4"
+	job := domain.Job{
+		ID:             "job-id",
+		Status:         domain.JobCompleted,
+		Packaging:      domain.PackagingHLS,
+		MasterPlaylist: "job-id/master.m3u8",
+		MediaPlaylists: domain.StringList{"job-id/720p.m3u8"},
+		Video:          video,
+	}
+
+	completed := messages.NewCompletedResult(job, []messages.Object{{Key: "job-id/stream.mpd", Size: 3}})
+	require.Nil(t, completed.Validate())
+	require.Equal(t, "resource", completed.ResourceID)
+	require.Equal(t, "COMPLETED", completed.JobStatus)
+	require.Equal(t, []string{"job-id/720p.m3u8"}, completed.MediaPlaylists)
+
+	document, err := json.Marshal(completed)
+	require.Nil(t, err)
+	require.NotContains(t, string(document), `"video"`)
+
+	completed.JobID = ""
+	require.Error(t, completed.Validate())
+
+	_, err = messages.ParseJobRequest([]byte(`{"file_path": "emilly.mp4"}`))
+	failed := messages.NewFailedResult([]byte(`{"file_path": "emilly.mp4"}`), domain.Job{}, err, 1)
+	require.Nil(t, failed.Validate())
+	require.Equal(t, []messages.FieldError{{Field: "resource_id", Message: "resource_id is required"}}, failed.Errors)
+
+	failed.Error = ""
+	require.Error(t, failed.Validate())
+}
+
+func TestJobRequestFingerprint(t *testing.T) {
+	first, err := messages.ParseJobRequest([]byte(`{"resource_id": "resource", "file_path": "emilly.mp4", "preset": "web-hd"}`))
+	require.Nil(t, err)
+	second, err := messages.ParseJobRequest([]byte(`{"version": 1, "preset": "web-hd", "file_path": "emilly.mp4", "resource_id": "resource"}`))
+	require.Nil(t, err)
+	require.Equal(t, first.Fingerprint(), second.Fingerprint())
+
+	second.Captions = domain.Captions{{Language: "pt-BR", FilePath: "emilly.srt"}}
+	require.NotEqual(t, first.Fingerprint(), second.Fingerprint())
+}
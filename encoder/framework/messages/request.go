@@ -0,0 +1,68 @@
+package messages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+// JobRequest é o pedido de processamento de um vídeo, consumido da fila de jobs. A versão
+// 1 aceita também o payload anterior ao versionamento, {"resource_id", "file_path"}.
+type JobRequest struct {
+	Version      int              `json:"version"`
+	ResourceID   string           `json:"resource_id"`
+	FilePath     string           `json:"file_path"`
+	Preset       string           `json:"preset,omitempty"`
+	Packaging    string           `json:"packaging,omitempty"`
+	AccessPolicy string           `json:"access_policy,omitempty"`
+	Captions     []domain.Caption `json:"captions,omitempty"`
+}
+
+// ParseJobRequest valida body contra o schema da sua versão e o decodifica. Os erros de
+// validação são retornados como *ValidationError, com um FieldError por campo inválido.
+func ParseJobRequest(body []byte) (*JobRequest, error) {
+	requestVersion, err := version(body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validate(jobRequestSchemas, requestVersion, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &JobRequest{}
+	err = json.Unmarshal(body, request)
+	if err != nil {
+		return nil, err
+	}
+	request.Version = requestVersion
+
+	return request, nil
+}
+
+// Fingerprint identifica as opções de processamento do pedido: preset, empacotamento,
+// política de acesso e legendas. Pedidos do mesmo arquivo com o mesmo fingerprint produzem
+// o mesmo resultado.
+func (r *JobRequest) Fingerprint() string {
+	options, _ := json.Marshal(struct {
+		Preset       string           `json:"preset"`
+		Packaging    string           `json:"packaging"`
+		AccessPolicy string           `json:"access_policy"`
+		Captions     []domain.Caption `json:"captions"`
+	}{r.Preset, r.Packaging, r.AccessPolicy, r.Captions})
+
+	sum := sha256.Sum256(options)
+	return hex.EncodeToString(sum[:])
+}
+
+// Video retorna o vídeo do pedido, ainda sem ID.
+func (r *JobRequest) Video() *domain.Video {
+	video := domain.NewVideo()
+	video.ResourceID = r.ResourceID
+	video.FilePath = r.FilePath
+	video.Captions = r.Captions
+	return video
+}
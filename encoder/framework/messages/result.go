@@ -0,0 +1,108 @@
+package messages
+
+import (
+	"encoding/json"
+
+	"github.com/zemartins81/encoderVideoGolang/domain"
+)
+
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Object é um objeto enviado ao bucket de saída.
+type Object struct {
+	Key     string `json:"key"`
+	Size    int64  `json:"size"`
+	MD5     string `json:"md5"`
+	CRC32C  string `json:"crc32c"`
+	Skipped bool   `json:"skipped"`
+	URL     string `json:"url,omitempty"`
+}
+
+// JobResult é a notificação publicada ao fim do processamento de uma mensagem. Jobs
+// concluídos trazem as saídas do job e os objetos enviados; falhas trazem a mensagem
+// original, o erro e, quando a mensagem é inválida, os erros por campo em Errors.
+type JobResult struct {
+	Version          int          `json:"version"`
+	Status           string       `json:"status"`
+	JobID            string       `json:"job_id,omitempty"`
+	JobStatus        string       `json:"job_status,omitempty"`
+	ResourceID       string       `json:"resource_id,omitempty"`
+	FilePath         string       `json:"file_path,omitempty"`
+	OutputBucketPath string       `json:"output_bucket_path,omitempty"`
+	Packaging        string       `json:"packaging,omitempty"`
+	Preset           string       `json:"preset,omitempty"`
+	ManifestPath     string       `json:"manifest_path,omitempty"`
+	MasterPlaylist   string       `json:"master_playlist,omitempty"`
+	MediaPlaylists   []string     `json:"media_playlists,omitempty"`
+	Poster           string       `json:"poster,omitempty"`
+	Thumbnails       []string     `json:"thumbnails,omitempty"`
+	SpriteTrack      string       `json:"sprite_track,omitempty"`
+	KID              string       `json:"kid,omitempty"`
+	Objects          []Object     `json:"objects,omitempty"`
+	Message          string       `json:"message,omitempty"`
+	Error            string       `json:"error,omitempty"`
+	Errors           []FieldError `json:"errors,omitempty"`
+	Attempts         int          `json:"attempts,omitempty"`
+}
+
+// NewCompletedResult cria o resultado de um job concluído.
+func NewCompletedResult(job domain.Job, objects []Object) *JobResult {
+	result := &JobResult{
+		Version: Version,
+		Status:  StatusCompleted,
+		Objects: objects,
+	}
+	result.setJob(job)
+	return result
+}
+
+// NewFailedResult cria o resultado da mensagem body que falhou com err após attempts
+// tentativas. job é vazio quando a falha ocorreu antes da criação do job.
+func NewFailedResult(body []byte, job domain.Job, err error, attempts int) *JobResult {
+	result := &JobResult{
+		Version:  Version,
+		Status:   StatusFailed,
+		Message:  string(body),
+		Error:    err.Error(),
+		Errors:   FieldErrors(err),
+		Attempts: attempts,
+	}
+	result.setJob(job)
+	return result
+}
+
+// setJob copia para o resultado os campos públicos do job, sem expor o modelo interno.
+func (r *JobResult) setJob(job domain.Job) {
+	r.JobID = job.ID
+	r.JobStatus = string(job.Status)
+	r.OutputBucketPath = job.OutputBucketPath
+	r.Packaging = job.Packaging
+	r.Preset = job.PresetName
+	r.ManifestPath = job.ManifestPath
+	r.MasterPlaylist = job.MasterPlaylist
+	r.MediaPlaylists = job.MediaPlaylists
+	r.Poster = job.Poster
+	r.Thumbnails = job.Thumbnails
+	r.SpriteTrack = job.SpriteTrack
+	r.KID = job.KID
+	r.setVideo(job.Video)
+}
+
+func (r *JobResult) setVideo(video *domain.Video) {
+	if video != nil {
+		r.ResourceID = video.ResourceID
+		r.FilePath = video.FilePath
+	}
+}
+
+// Validate valida o resultado contra o schema da sua versão.
+func (r *JobResult) Validate() error {
+	document, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return validate(jobResultSchemas, r.Version, document)
+}
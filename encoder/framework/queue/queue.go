@@ -1,12 +1,46 @@
 package queue
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
 
+// ErrClosed é retornado pelas operações feitas depois de Close.
+var ErrClosed = errors.New("rabbitmq connection closed")
+
+// Cabeçalhos das mensagens reenviadas às filas de retry e ao dead-letter exchange.
+const (
+	// HeaderAttempts guarda quantas vezes a mensagem já foi processada sem sucesso.
+	HeaderAttempts = "x-attempts"
+	// HeaderError guarda o erro da última tentativa.
+	HeaderError = "x-error"
+)
+
+// Nomes dos consumidores, usados nos logs e para localizar o consumidor da fila de jobs.
+const (
+	jobConsumer     = "consumer"
+	controlConsumer = "control"
+)
+
+const (
+	defaultReconnectDelay    = time.Second
+	defaultReconnectMaxDelay = 30 * time.Second
+	defaultConnectAttempts   = 5
+	// defaultRetryDelay é a espera das novas tentativas quando RABBITMQ_MAX_ATTEMPTS pede
+	// mais de uma tentativa sem definir RABBITMQ_RETRY_DELAYS.
+	defaultRetryDelay = 30 * time.Second
+	// confirmTimeout é quanto publish espera o broker confirmar uma mensagem.
+	confirmTimeout = 10 * time.Second
+)
+
 type RabbitMQ struct {
 	User              string
 	Password          string
@@ -15,9 +49,127 @@ type RabbitMQ struct {
 	Vhost             string
 	ConsumerQueueName string
 	ConsumerName      string
+	ControlExchange   string
 	AutoAck           bool
 	Args              amqp.Table
 	Channel           *amqp.Channel
+	// DeadLetterExchange recebe as mensagens que esgotaram as tentativas.
+	DeadLetterExchange string
+	// RetryDelays são as esperas antes de cada nova tentativa, uma fila de retry com TTL
+	// por espera. A partir da última, a mesma espera é reaproveitada.
+	RetryDelays []time.Duration
+	// MaxAttempts é o total de tentativas antes do dead-letter, incluindo a primeira.
+	MaxAttempts int
+	// PrefetchCount limita as mensagens entregues e ainda não confirmadas ao consumidor da
+	// fila de jobs. Zero deixa o limite a cargo de quem consome.
+	PrefetchCount int
+	// ReconnectDelay é a espera antes da primeira tentativa de reconexão; a espera dobra a
+	// cada falha até ReconnectMaxDelay.
+	ReconnectDelay    time.Duration
+	ReconnectMaxDelay time.Duration
+	// ConnectAttempts é o total de tentativas de Connect antes de desistir e retornar o
+	// erro. Zero usa defaultConnectAttempts.
+	ConnectAttempts int
+
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	confirms  *confirmer
+	consumers []*consumer
+	closed    bool
+	// publishMu serializa as publicações para que cada uma espere a própria confirmação.
+	publishMu sync.Mutex
+}
+
+// confirmer acompanha as confirmações de publicação de um canal em modo confirm. As
+// delivery tags recomeçam em 1 a cada canal, por isso um confirmer novo é criado a cada
+// reconexão. As confirmações são lidas por uma goroutine própria, mesmo as que chegam
+// depois de a publicação desistir de esperar, para que nunca travem a leitura da conexão.
+type confirmer struct {
+	mu        sync.Mutex
+	published uint64
+	waiting   map[uint64]chan amqp.Confirmation
+	closed    bool
+}
+
+func newConfirmer(confirmations <-chan amqp.Confirmation) *confirmer {
+	c := &confirmer{waiting: map[uint64]chan amqp.Confirmation{}}
+	go c.drain(confirmations)
+	return c
+}
+
+// drain entrega cada confirmação à publicação que a espera, descartando as demais, até o
+// canal ser fechado. Depois disso, as esperas pendentes são encerradas.
+func (c *confirmer) drain(confirmations <-chan amqp.Confirmation) {
+	for confirmation := range confirmations {
+		c.mu.Lock()
+		waiter, ok := c.waiting[confirmation.DeliveryTag]
+		delete(c.waiting, confirmation.DeliveryTag)
+		c.mu.Unlock()
+
+		if ok {
+			waiter <- confirmation
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for tag, waiter := range c.waiting {
+		close(waiter)
+		delete(c.waiting, tag)
+	}
+}
+
+// expect reserva a delivery tag da próxima publicação e retorna o canal em que sua
+// confirmação será entregue. Deve ser chamado antes de publicar, para que a confirmação
+// não chegue antes da espera ser registrada.
+func (c *confirmer) expect() (uint64, <-chan amqp.Confirmation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	waiter := make(chan amqp.Confirmation, 1)
+	if c.closed {
+		close(waiter)
+		return 0, waiter
+	}
+
+	tag := c.published + 1
+	c.waiting[tag] = waiter
+	return tag, waiter
+}
+
+// sent registra que a publicação com a tag reservada por expect foi enviada.
+func (c *confirmer) sent(tag uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = tag
+}
+
+// forget descarta a espera da tag, quando a publicação falha ou desiste de esperar.
+func (c *confirmer) forget(tag uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.waiting, tag)
+}
+
+// consumer guarda como registrar um consumidor em um canal novo, para que ele seja
+// recriado depois de uma reconexão.
+// channel são as operações de *amqp.Channel usadas para declarar as filas e registrar os
+// consumidores.
+type channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+}
+
+type consumer struct {
+	name       string
+	tag        string
+	setup      func(ch channel) (<-chan amqp.Delivery, error)
+	deliveries chan (<-chan amqp.Delivery)
+	stop       chan struct{}
 }
 
 func NewRabbitMQ() *RabbitMQ {
@@ -25,86 +177,643 @@ func NewRabbitMQ() *RabbitMQ {
 	rabbitMQArgs := amqp.Table{}
 	rabbitMQArgs["x-dead-letter-exchange"] = os.Getenv("RABBITMQ_DLX")
 
+	retryDelays := durationListEnv("RABBITMQ_RETRY_DELAYS")
+	maxAttempts, err := strconv.Atoi(os.Getenv("RABBITMQ_MAX_ATTEMPTS"))
+	if err != nil || maxAttempts < 1 {
+		maxAttempts = len(retryDelays) + 1
+	}
+	// Sem esperas não há filas de retry, e toda falha iria direto para o dead-letter.
+	if maxAttempts > 1 && len(retryDelays) == 0 {
+		log.Printf("RABBITMQ_MAX_ATTEMPTS is %d but RABBITMQ_RETRY_DELAYS is empty, retrying after %s", maxAttempts, defaultRetryDelay)
+		retryDelays = []time.Duration{defaultRetryDelay}
+	}
+
+	connectAttempts, err := strconv.Atoi(os.Getenv("RABBITMQ_CONNECT_ATTEMPTS"))
+	if err != nil || connectAttempts < 1 {
+		connectAttempts = defaultConnectAttempts
+	}
+
+	prefetchCount, err := strconv.Atoi(os.Getenv("RABBITMQ_PREFETCH_COUNT"))
+	if err != nil || prefetchCount < 0 {
+		prefetchCount = 0
+	}
+
 	rabbitMQ := RabbitMQ{
-		User:              os.Getenv("RABBITMQ_DEFAULT_USER"),
-		Password:          os.Getenv("RABBITMQ_DEFAULT_PASS"),
-		Host:              os.Getenv("RABBITMQ_DEFAULT_HOST"),
-		Port:              os.Getenv("RABBITMQ_DEFAULT_PORT"),
-		Vhost:             os.Getenv("RABBITMQ_DEFAULT_VHOST"),
-		ConsumerQueueName: os.Getenv("RABBITMQ_CONSUMER_QUEUE_NAME"),
-		ConsumerName:      os.Getenv("RABBITMQ_CONSUMER_NAME"),
-		AutoAck:           false,
-		Args:              rabbitMQArgs,
+		User:               os.Getenv("RABBITMQ_DEFAULT_USER"),
+		Password:           os.Getenv("RABBITMQ_DEFAULT_PASS"),
+		Host:               os.Getenv("RABBITMQ_DEFAULT_HOST"),
+		Port:               os.Getenv("RABBITMQ_DEFAULT_PORT"),
+		Vhost:              os.Getenv("RABBITMQ_DEFAULT_VHOST"),
+		ConsumerQueueName:  os.Getenv("RABBITMQ_CONSUMER_QUEUE_NAME"),
+		ConsumerName:       os.Getenv("RABBITMQ_CONSUMER_NAME"),
+		ControlExchange:    os.Getenv("RABBITMQ_CONTROL_EXCHANGE"),
+		AutoAck:            false,
+		Args:               rabbitMQArgs,
+		DeadLetterExchange: os.Getenv("RABBITMQ_DLX"),
+		RetryDelays:        retryDelays,
+		MaxAttempts:        maxAttempts,
+		PrefetchCount:      prefetchCount,
+		ReconnectDelay:     durationEnv("RABBITMQ_RECONNECT_DELAY", defaultReconnectDelay),
+		ReconnectMaxDelay:  durationEnv("RABBITMQ_RECONNECT_MAX_DELAY", defaultReconnectMaxDelay),
+		ConnectAttempts:    connectAttempts,
 	}
 
 	return &rabbitMQ
 }
 
-func (r *RabbitMQ) Connect() *amqp.Channel {
+// Connect abre a conexão e o canal com o RabbitMQ, repetindo as tentativas que falharem
+// com a mesma espera exponencial das reconexões. Depois de ConnectAttempts tentativas,
+// retorna o erro da última, para que um host ou credenciais errados falhem logo. Quando a
+// conexão ou o canal caem depois de abertos, eles são reabertos em segundo plano e os
+// consumidores registrados são recriados.
+func (r *RabbitMQ) Connect() (*amqp.Channel, error) {
+	attempts := r.ConnectAttempts
+	if attempts < 1 {
+		attempts = defaultConnectAttempts
+	}
+	delay := r.reconnectDelay()
+
+	for attempt := 1; ; attempt++ {
+		ch, err := r.connect()
+		if err == nil || errors.Is(err, ErrClosed) {
+			return ch, err
+		}
+		if attempt == attempts {
+			return nil, fmt.Errorf("%w (after %d attempts)", err, attempts)
+		}
+
+		log.Printf("RabbitMQ connection attempt %d failed, retrying in %s: %v", attempt, delay, err)
+		time.Sleep(delay)
+		delay = nextDelay(delay, r.ReconnectMaxDelay)
+	}
+}
+
+// connect faz uma única tentativa de abrir a conexão.
+func (r *RabbitMQ) connect() (*amqp.Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, ErrClosed
+	}
+
+	conn, ch, confirms, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+	r.conn = conn
+	r.Channel = ch
+	r.confirms = confirms
+
+	go r.watch(conn, ch)
+
+	return ch, nil
+}
+
+// dial abre a conexão e um canal em modo confirm, em que o broker confirma cada
+// mensagem publicada.
+func (r *RabbitMQ) dial() (*amqp.Connection, *amqp.Channel, *confirmer, error) {
 	dsn := "amqp://" + r.User + ":" + r.Password + "@" + r.Host + ":" + r.Port + r.Vhost
 	conn, err := amqp.Dial(dsn)
-	failOnError(err, "Failed to connect to RabbitMQ")
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
 
-	r.Channel, err = conn.Channel()
-	failOnError(err, "Failed to open a channel")
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to put the channel in confirm mode: %w", err)
+	}
+	confirms := newConfirmer(ch.NotifyPublish(make(chan amqp.Confirmation, 1)))
 
-	return r.Channel
+	return conn, ch, confirms, nil
 }
 
-func (r *RabbitMQ) Consume(messageChannel chan amqp.Delivery) {
+// watch espera o fechamento da conexão ou do canal e reconecta, a menos que Close tenha
+// sido chamado.
+func (r *RabbitMQ) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
 
-	q, err := r.Channel.QueueDeclare(
-		r.ConsumerQueueName, // name
-		true,                // durable
-		false,               // delete when usused
-		false,               // exclusive
-		false,               // no-wait
-		r.Args,              // arguments
-	)
-	failOnError(err, "failed to declare a queue")
-
-	incomingMessage, err := r.Channel.Consume(
-		q.Name,         // queue
-		r.ConsumerName, // consumer
-		r.AutoAck,      // auto-ack
-		false,          // exclusive
-		false,          // no-local
-		false,          // no-wait
-		nil,            // args
-	)
-	failOnError(err, "Failed to register a consumer")
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-chClosed:
+		// Sem o canal a conexão não serve para nada; ela é fechada e reaberta por inteiro.
+		conn.Close()
+	}
 
-	go func() {
-		for message := range incomingMessage {
-			log.Println("Incoming new message")
-			messageChannel <- message
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return
+	}
+
+	log.Printf("RabbitMQ connection lost: %v", reason)
+	r.reconnect()
+}
+
+// reconnect tenta reabrir a conexão com espera exponencial entre as tentativas, até
+// conseguir ou até Close ser chamado.
+func (r *RabbitMQ) reconnect() {
+	delay := r.reconnectDelay()
+
+	for attempt := 1; ; attempt++ {
+		time.Sleep(delay)
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return
 		}
-		log.Println("RabbitMQ channel closed")
-		close(messageChannel)
-	}()
+
+		err := r.restore()
+		r.mu.Unlock()
+		if err == nil {
+			log.Printf("RabbitMQ connection restored after %d attempt(s)", attempt)
+			return
+		}
+
+		log.Printf("RabbitMQ reconnection attempt %d failed: %v", attempt, err)
+		delay = nextDelay(delay, r.ReconnectMaxDelay)
+	}
+}
+
+// restore reabre a conexão e recria os consumidores. Deve ser chamado com r.mu travado.
+func (r *RabbitMQ) restore() error {
+	conn, ch, confirms, err := r.dial()
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := r.setupConsumers(ch)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	r.conn = conn
+	r.Channel = ch
+	r.confirms = confirms
+	for i, c := range r.consumers {
+		// Um canal de entregas ainda não lido já foi fechado e pode ser descartado.
+		select {
+		case <-c.deliveries:
+		default:
+		}
+		c.deliveries <- deliveries[i]
+	}
+
+	go r.watch(conn, ch)
+
+	return nil
+}
+
+// setupConsumers registra de novo no canal ch todos os consumidores, retornando suas
+// entregas na ordem de r.consumers.
+func (r *RabbitMQ) setupConsumers(ch channel) ([]<-chan amqp.Delivery, error) {
+	deliveries := make([]<-chan amqp.Delivery, len(r.consumers))
+	for i, c := range r.consumers {
+		var err error
+		deliveries[i], err = c.setup(ch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore consumer %s: %w", c.name, err)
+		}
+	}
+	return deliveries, nil
+}
+
+// reconnectDelay retorna a espera antes da primeira nova tentativa de conexão.
+func (r *RabbitMQ) reconnectDelay() time.Duration {
+	if r.ReconnectDelay <= 0 {
+		return defaultReconnectDelay
+	}
+	return r.ReconnectDelay
+}
+
+// nextDelay dobra delay sem passar de max.
+func nextDelay(delay time.Duration, max time.Duration) time.Duration {
+	if max <= 0 {
+		max = defaultReconnectMaxDelay
+	}
+	delay *= 2
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// addConsumer registra o consumidor no canal atual e encaminha suas mensagens para out,
+// inclusive depois das reconexões. out só é fechado por Close.
+func (r *RabbitMQ) addConsumer(name string, tag string, out chan amqp.Delivery, setup func(ch channel) (<-chan amqp.Delivery, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	if r.Channel == nil {
+		return errors.New("rabbitmq is not connected")
+	}
+
+	deliveries, err := setup(r.Channel)
+	if err != nil {
+		return err
+	}
+
+	c := &consumer{
+		name:       name,
+		tag:        tag,
+		setup:      setup,
+		deliveries: make(chan (<-chan amqp.Delivery), 1),
+		stop:       make(chan struct{}),
+	}
+	r.consumers = append(r.consumers, c)
+
+	go c.forward(deliveries, out)
+
+	return nil
+}
+
+// forward encaminha as entregas para out. Depois de stop, as entregas que ainda chegarem
+// são devolvidas à fila em vez de encaminhadas.
+func (c *consumer) forward(deliveries <-chan amqp.Delivery, out chan amqp.Delivery) {
+	for {
+		for message := range deliveries {
+			select {
+			case <-c.stop:
+				c.requeue(message)
+				continue
+			default:
+			}
+
+			select {
+			case out <- message:
+			case <-c.stop:
+				c.requeue(message)
+			}
+		}
+		log.Printf("RabbitMQ %s channel closed", c.name)
+
+		next, ok := <-c.deliveries
+		if !ok {
+			close(out)
+			return
+		}
+		deliveries = next
+	}
+}
+
+func (c *consumer) requeue(message amqp.Delivery) {
+	err := message.Nack(false, true)
+	if err != nil {
+		log.Printf("error requeueing message of RabbitMQ %s: %v", c.name, err)
+	}
+}
+
+// StopConsuming cancela o consumidor da fila de jobs sem fechar a conexão, para que as
+// mensagens em processamento ainda possam ser confirmadas. As entregas que não chegaram aos
+// workers voltam para a fila e o canal passado a Consume é fechado.
+func (r *RabbitMQ) StopConsuming() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.consumers {
+		if c.name != jobConsumer {
+			continue
+		}
+
+		r.consumers = append(r.consumers[:i], r.consumers[i+1:]...)
+		close(c.stop)
+		close(c.deliveries)
+
+		if r.Channel == nil {
+			return nil
+		}
+		return r.Channel.Cancel(c.tag, false)
+	}
+	return nil
+}
+
+// consumerTag retorna a identificação do consumidor da fila de jobs, usada para
+// cancelá-lo em StopConsuming.
+func (r *RabbitMQ) consumerTag() string {
+	if r.ConsumerName != "" {
+		return r.ConsumerName
+	}
+	return "encoder-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Consume declara a fila de jobs e encaminha suas mensagens para messageChannel, com no
+// máximo PrefetchCount mensagens não confirmadas por vez.
+func (r *RabbitMQ) Consume(messageChannel chan amqp.Delivery) error {
+	tag := r.consumerTag()
+	return r.addConsumer(jobConsumer, tag, messageChannel, r.jobConsumerSetup(tag))
+}
+
+// jobConsumerSetup retorna a configuração do consumidor tag da fila de jobs, refeita a
+// cada reconexão.
+func (r *RabbitMQ) jobConsumerSetup(tag string) func(ch channel) (<-chan amqp.Delivery, error) {
+	return func(ch channel) (<-chan amqp.Delivery, error) {
+		q, err := ch.QueueDeclare(
+			r.ConsumerQueueName, // name
+			true,                // durable
+			false,               // delete when usused
+			false,               // exclusive
+			false,               // no-wait
+			r.Args,              // arguments
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to declare a queue: %w", err)
+		}
+
+		err = r.declareRetryQueues(ch, q.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// O limite vale para os consumidores registrados depois no canal, e por isso é
+		// reaplicado a cada reconexão.
+		if r.PrefetchCount > 0 {
+			err = ch.Qos(r.PrefetchCount, 0, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to set the prefetch count: %w", err)
+			}
+		}
+
+		incomingMessage, err := ch.Consume(
+			q.Name,    // queue
+			tag,       // consumer
+			r.AutoAck, // auto-ack
+			false,     // exclusive
+			false,     // no-local
+			false,     // no-wait
+			nil,       // args
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register a consumer: %w", err)
+		}
+
+		return incomingMessage, nil
+	}
+}
+
+// ConsumeControl consome os comandos de controle, como o cancelamento de jobs, publicados
+// no exchange fanout ControlExchange. Cada instância declara sua própria fila exclusiva,
+// de modo que todas recebem todos os comandos.
+func (r *RabbitMQ) ConsumeControl(controlChannel chan amqp.Delivery) error {
+	return r.addConsumer(controlConsumer, "", controlChannel, func(ch channel) (<-chan amqp.Delivery, error) {
+		err := ch.ExchangeDeclare(
+			r.ControlExchange, // name
+			"fanout",          // type
+			true,              // durable
+			false,             // auto-deleted
+			false,             // internal
+			false,             // no-wait
+			nil,               // arguments
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to declare the control exchange: %w", err)
+		}
+
+		q, err := ch.QueueDeclare(
+			"",    // name
+			false, // durable
+			true,  // delete when usused
+			true,  // exclusive
+			false, // no-wait
+			nil,   // arguments
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to declare the control queue: %w", err)
+		}
+
+		err = ch.QueueBind(q.Name, "", r.ControlExchange, false, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to bind the control queue: %w", err)
+		}
+
+		incomingCommand, err := ch.Consume(
+			q.Name, // queue
+			"",     // consumer
+			true,   // auto-ack
+			true,   // exclusive
+			false,  // no-local
+			false,  // no-wait
+			nil,    // args
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the control consumer: %w", err)
+		}
+
+		return incomingCommand, nil
+	})
+}
+
+// declareRetryQueues declara uma fila de retry para cada espera de RetryDelays. As
+// mensagens expiram após a espera e voltam para a fila queue pelo exchange padrão.
+func (r *RabbitMQ) declareRetryQueues(ch channel, queue string) error {
+	for i, delay := range r.RetryDelays {
+		_, err := ch.QueueDeclare(
+			retryQueueName(queue, i+1), // name
+			true,                       // durable
+			false,                      // delete when usused
+			false,                      // exclusive
+			false,                      // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare the retry queue for %s: %w", delay, err)
+		}
+	}
+	return nil
+}
+
+func retryQueueName(queue string, level int) string {
+	return fmt.Sprintf("%s.retry.%d", queue, level)
+}
+
+// Attempts retorna quantas vezes a mensagem já foi processada sem sucesso, segundo o
+// cabeçalho HeaderAttempts.
+func Attempts(message amqp.Delivery) int {
+	switch attempts := message.Headers[HeaderAttempts].(type) {
+	case int:
+		return attempts
+	case int16:
+		return int(attempts)
+	case int32:
+		return int(attempts)
+	case int64:
+		return int(attempts)
+	}
+	return 0
+}
+
+// retryLevel retorna a fila de retry, a partir de 1, para a mensagem que falhou pela
+// attempts-ésima vez, ou 0 quando as tentativas se esgotaram.
+func (r *RabbitMQ) retryLevel(attempts int) int {
+	if len(r.RetryDelays) == 0 || attempts >= r.MaxAttempts {
+		return 0
+	}
+	if attempts > len(r.RetryDelays) {
+		return len(r.RetryDelays)
+	}
+	return attempts
+}
+
+// Retry reenvia a mensagem que falhou com cause para a fila de retry da tentativa atual
+// ou, se as tentativas se esgotaram, para o dead-letter exchange. Informa se a mensagem
+// será processada de novo. A mensagem original deve ser confirmada pelo chamador.
+func (r *RabbitMQ) Retry(message amqp.Delivery, cause error) (bool, error) {
+	attempts := Attempts(message) + 1
+	level := r.retryLevel(attempts)
+	if level == 0 {
+		return false, r.DeadLetter(message, cause)
+	}
+
+	log.Printf("retrying message after %d attempt(s) in %s", attempts, r.RetryDelays[level-1])
+	return true, r.republish(message, "", retryQueueName(r.ConsumerQueueName, level), attempts, cause)
+}
+
+// DeadLetter envia a mensagem que falhou com cause para o dead-letter exchange, com o
+// erro no cabeçalho HeaderError. A mensagem original deve ser confirmada pelo chamador.
+func (r *RabbitMQ) DeadLetter(message amqp.Delivery, cause error) error {
+	if r.DeadLetterExchange == "" {
+		return errors.New("no dead-letter exchange configured")
+	}
+	return r.republish(message, r.DeadLetterExchange, message.RoutingKey, Attempts(message)+1, cause)
+}
+
+func (r *RabbitMQ) republish(message amqp.Delivery, exchange string, routingKey string, attempts int, cause error) error {
+	headers := amqp.Table{}
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+	headers[HeaderAttempts] = int32(attempts)
+	if cause != nil {
+		headers[HeaderError] = cause.Error()
+	}
+
+	return r.publish(exchange, routingKey, amqp.Publishing{
+		Headers:         headers,
+		ContentType:     message.ContentType,
+		ContentEncoding: message.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		CorrelationId:   message.CorrelationId,
+		MessageId:       message.MessageId,
+		Timestamp:       message.Timestamp,
+		Body:            message.Body,
+	})
 }
 
 func (r *RabbitMQ) Notify(message string, contentType string, exchange string, routingKey string) error {
+	return r.publish(exchange, routingKey, amqp.Publishing{
+		ContentType: contentType,
+		Body:        []byte(message),
+	})
+}
+
+// publish publica a mensagem e espera o broker confirmá-la. Um erro indica que a
+// mensagem pode não ter sido gravada, e a original não deve ser confirmada.
+func (r *RabbitMQ) publish(exchange string, routingKey string, message amqp.Publishing) error {
+	r.publishMu.Lock()
+	defer r.publishMu.Unlock()
 
-	err := r.Channel.Publish(
+	r.mu.Lock()
+	ch := r.Channel
+	confirms := r.confirms
+	r.mu.Unlock()
+
+	if ch == nil || confirms == nil {
+		return errors.New("rabbitmq is not connected")
+	}
+
+	tag, waiter := confirms.expect()
+	err := ch.Publish(
 		exchange,   // exchange
 		routingKey, // routing key
 		false,      // mandatory
 		false,      // immediate
-		amqp.Publishing{
-			ContentType: contentType,
-			Body:        []byte(message),
-		})
+		message,
+	)
 
 	if err != nil {
+		confirms.forget(tag)
 		return err
 	}
 
-	return nil
+	confirms.sent(tag)
+	return confirms.wait(tag, waiter, confirmTimeout)
 }
 
-func failOnError(err error, msg string) {
-	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
+// wait espera a confirmação da mensagem com a delivery tag informada. Se o tempo acabar,
+// a espera é descartada e a confirmação, quando chegar, é ignorada.
+func (c *confirmer) wait(tag uint64, waiter <-chan amqp.Confirmation, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case confirmation, ok := <-waiter:
+		if !ok {
+			return errors.New("channel closed before the publish was confirmed")
+		}
+		if !confirmation.Ack {
+			return errors.New("publish was rejected by the broker")
+		}
+		return nil
+	case <-timer.C:
+		c.forget(tag)
+		return fmt.Errorf("publish was not confirmed within %s", timeout)
+	}
+}
+
+// Close encerra a conexão sem reconectar e fecha os canais entregues a Consume e
+// ConsumeControl depois que suas mensagens pendentes forem encaminhadas.
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	for _, c := range r.consumers {
+		close(c.deliveries)
+	}
+
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+// durationListEnv lê uma lista de durações separadas por vírgula, ignorando as inválidas.
+func durationListEnv(name string) []time.Duration {
+	var durations []time.Duration
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err == nil && duration > 0 {
+			durations = append(durations, duration)
+		}
+	}
+	return durations
+}
+
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
 	}
+	return value
 }
@@ -0,0 +1,257 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextDelay(t *testing.T) {
+	require.Equal(t, 2*time.Second, nextDelay(time.Second, 30*time.Second))
+	require.Equal(t, 30*time.Second, nextDelay(20*time.Second, 30*time.Second))
+	require.Equal(t, defaultReconnectMaxDelay, nextDelay(time.Minute, 0))
+}
+
+func TestConsumerForwardsAcrossReconnections(t *testing.T) {
+	c := &consumer{name: "test", deliveries: make(chan (<-chan amqp.Delivery), 1)}
+	out := make(chan amqp.Delivery)
+
+	first := make(chan amqp.Delivery, 1)
+	go c.forward(first, out)
+
+	first <- amqp.Delivery{Body: []byte("first")}
+	require.Equal(t, "first", string((<-out).Body))
+
+	// A queda do canal não fecha out; as mensagens seguem pelo canal recriado.
+	close(first)
+	second := make(chan amqp.Delivery, 1)
+	c.deliveries <- second
+	second <- amqp.Delivery{Body: []byte("second")}
+	require.Equal(t, "second", string((<-out).Body))
+
+	close(second)
+	close(c.deliveries)
+	_, ok := <-out
+	require.False(t, ok)
+}
+
+func TestCloseWithoutConnection(t *testing.T) {
+	r := &RabbitMQ{}
+	require.Nil(t, r.Close())
+
+	_, err := r.Connect()
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorIs(t, r.Consume(make(chan amqp.Delivery)), ErrClosed)
+}
+
+func TestConnectReturnsErrorForUnreachableBroker(t *testing.T) {
+	r := &RabbitMQ{Host: "127.0.0.1", Port: "1", ReconnectDelay: time.Millisecond, ConnectAttempts: 3}
+
+	_, err := r.Connect()
+	require.ErrorContains(t, err, "failed to connect to RabbitMQ")
+	require.ErrorContains(t, err, "after 3 attempts")
+}
+
+func TestConnectRetriesUntilClosed(t *testing.T) {
+	r := &RabbitMQ{Host: "127.0.0.1", Port: "1", ReconnectDelay: time.Millisecond, ReconnectMaxDelay: 5 * time.Millisecond, ConnectAttempts: 1000}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := r.Connect()
+		result <- err
+	}()
+
+	// Sem broker, Connect continua tentando em vez de retornar o erro.
+	select {
+	case err := <-result:
+		t.Fatalf("Connect returned before Close: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.Nil(t, r.Close())
+	select {
+	case err := <-result:
+		require.ErrorIs(t, err, ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Connect did not stop after Close")
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	require.Equal(t, 0, Attempts(amqp.Delivery{}))
+	require.Equal(t, 2, Attempts(amqp.Delivery{Headers: amqp.Table{HeaderAttempts: int32(2)}}))
+	require.Equal(t, 3, Attempts(amqp.Delivery{Headers: amqp.Table{HeaderAttempts: int64(3)}}))
+	require.Equal(t, 0, Attempts(amqp.Delivery{Headers: amqp.Table{HeaderAttempts: "3"}}))
+}
+
+func TestRetryLevel(t *testing.T) {
+	r := &RabbitMQ{RetryDelays: []time.Duration{time.Second, time.Minute}, MaxAttempts: 5}
+	require.Equal(t, 1, r.retryLevel(1))
+	require.Equal(t, 2, r.retryLevel(2))
+	require.Equal(t, 2, r.retryLevel(4))
+	require.Equal(t, 0, r.retryLevel(5))
+
+	r.RetryDelays = nil
+	require.Equal(t, 0, r.retryLevel(1))
+}
+
+func TestNewRabbitMQRetriesWithoutDelays(t *testing.T) {
+	t.Setenv("RABBITMQ_RETRY_DELAYS", "")
+	t.Setenv("RABBITMQ_MAX_ATTEMPTS", "3")
+
+	r := NewRabbitMQ()
+	require.Equal(t, []time.Duration{defaultRetryDelay}, r.RetryDelays)
+	require.Equal(t, 1, r.retryLevel(1))
+	require.Equal(t, 1, r.retryLevel(2))
+	require.Equal(t, 0, r.retryLevel(3))
+
+	t.Setenv("RABBITMQ_MAX_ATTEMPTS", "1")
+	require.Empty(t, NewRabbitMQ().RetryDelays)
+}
+
+func TestDeadLetterRequiresExchange(t *testing.T) {
+	r := &RabbitMQ{MaxAttempts: 1}
+	retried, err := r.Retry(amqp.Delivery{}, errors.New("failed"))
+	require.False(t, retried)
+	require.Error(t, err)
+}
+
+func TestDurationListEnv(t *testing.T) {
+	t.Setenv("RABBITMQ_RETRY_DELAYS", "10s, 1m,invalid,5m")
+	require.Equal(t, []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}, durationListEnv("RABBITMQ_RETRY_DELAYS"))
+}
+
+// fakeAcknowledger conta as mensagens devolvidas à fila.
+type fakeAcknowledger struct {
+	requeued int
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		a.requeued++
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestStopConsumingRequeuesUndeliveredMessages(t *testing.T) {
+	r := &RabbitMQ{}
+	out := make(chan amqp.Delivery)
+	deliveries := make(chan amqp.Delivery, 2)
+
+	c := &consumer{
+		name:       jobConsumer,
+		deliveries: make(chan (<-chan amqp.Delivery), 1),
+		stop:       make(chan struct{}),
+	}
+	r.consumers = append(r.consumers, c)
+	go c.forward(deliveries, out)
+
+	require.Nil(t, r.StopConsuming())
+	require.Empty(t, r.consumers)
+
+	ack := &fakeAcknowledger{}
+	deliveries <- amqp.Delivery{Acknowledger: ack}
+	deliveries <- amqp.Delivery{Acknowledger: ack}
+	close(deliveries)
+
+	_, ok := <-out
+	require.False(t, ok)
+	require.Equal(t, 2, ack.requeued)
+}
+
+func TestConfirmerWait(t *testing.T) {
+	confirmations := make(chan amqp.Confirmation)
+	c := newConfirmer(confirmations)
+
+	tag, waiter := c.expect()
+	c.sent(tag)
+	confirmations <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+	require.Nil(t, c.wait(tag, waiter, time.Second))
+
+	tag, waiter = c.expect()
+	c.sent(tag)
+	confirmations <- amqp.Confirmation{DeliveryTag: tag, Ack: false}
+	require.NotNil(t, c.wait(tag, waiter, time.Second))
+
+	// Uma confirmação que chega depois de a publicação desistir é lida e descartada sem
+	// travar quem a envia.
+	tag, waiter = c.expect()
+	c.sent(tag)
+	require.NotNil(t, c.wait(tag, waiter, 10*time.Millisecond))
+	confirmations <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+
+	tag, waiter = c.expect()
+	c.sent(tag)
+	close(confirmations)
+	require.NotNil(t, c.wait(tag, waiter, time.Second))
+
+	_, waiter = c.expect()
+	_, ok := <-waiter
+	require.False(t, ok)
+}
+
+// fakeChannel registra o prefetch count aplicado e os consumidores registrados.
+type fakeChannel struct {
+	prefetchCounts []int
+	consumers      []string
+}
+
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	c.prefetchCounts = append(c.prefetchCounts, prefetchCount)
+	return nil
+}
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	c.consumers = append(c.consumers, consumer)
+	return make(chan amqp.Delivery), nil
+}
+
+func TestJobConsumerAppliesPrefetchCountOnEveryChannel(t *testing.T) {
+	r := &RabbitMQ{ConsumerQueueName: "videos", PrefetchCount: 4}
+	r.consumers = []*consumer{{name: jobConsumer, tag: "encoder", setup: r.jobConsumerSetup("encoder")}}
+
+	ch := &fakeChannel{}
+	_, err := r.consumers[0].setup(ch)
+	require.Nil(t, err)
+	require.Equal(t, []int{4}, ch.prefetchCounts)
+
+	// Na reconexão, o limite é aplicado de novo no canal recriado.
+	restored := &fakeChannel{}
+	deliveries, err := r.setupConsumers(restored)
+	require.Nil(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, []int{4}, restored.prefetchCounts)
+	require.Equal(t, []string{"encoder"}, restored.consumers)
+}
+
+func TestJobConsumerWithoutPrefetchCount(t *testing.T) {
+	r := &RabbitMQ{ConsumerQueueName: "videos"}
+
+	ch := &fakeChannel{}
+	_, err := r.jobConsumerSetup("encoder")(ch)
+	require.Nil(t, err)
+	require.Empty(t, ch.prefetchCounts)
+}
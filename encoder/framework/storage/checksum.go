@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Hasher calcula simultaneamente o MD5 e o CRC32C (Castagnoli) dos bytes escritos,
+// os mesmos checksums expostos pelo GCS nos metadados dos objetos.
+type Hasher struct {
+	md5    hash.Hash
+	crc32c hash.Hash32
+	size   int64
+}
+
+func NewHasher() *Hasher {
+	return &Hasher{
+		md5:    md5.New(),
+		crc32c: crc32.New(crc32cTable),
+	}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.md5.Write(p)
+	h.crc32c.Write(p)
+	h.size += int64(len(p))
+	return len(p), nil
+}
+
+// Size retorna o total de bytes escritos.
+func (h *Hasher) Size() int64 {
+	return h.size
+}
+
+// MD5 retorna o MD5 dos bytes escritos.
+func (h *Hasher) MD5() []byte {
+	return h.md5.Sum(nil)
+}
+
+// CRC32C retorna o CRC32C dos bytes escritos.
+func (h *Hasher) CRC32C() uint32 {
+	return h.crc32c.Sum32()
+}
+
+// HashReader consome r e retorna o Hasher com os checksums do conteúdo lido.
+func HashReader(r io.Reader) (*Hasher, error) {
+	h := NewHasher()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// HasChecksum informa se o armazenamento informou algum checksum do conteúdo do objeto.
+func (info *ObjectInfo) HasChecksum() bool {
+	return len(info.MD5) > 0 || info.HasCRC32C
+}
+
+// Verify compara o tamanho e os checksums calculados por h com os metadados do
+// objeto. Checksums que o armazenamento não informa são ignorados.
+func (info *ObjectInfo) Verify(h *Hasher) error {
+	if h.Size() != info.Size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", info.Key, info.Size, h.Size())
+	}
+	if len(info.MD5) > 0 && !bytes.Equal(info.MD5, h.MD5()) {
+		return fmt.Errorf("md5 mismatch for %s: expected %x, got %x", info.Key, info.MD5, h.MD5())
+	}
+	if info.HasCRC32C && info.CRC32C != h.CRC32C() {
+		return fmt.Errorf("crc32c mismatch for %s: expected %08x, got %08x", info.Key, info.CRC32C, h.CRC32C())
+	}
+	return nil
+}
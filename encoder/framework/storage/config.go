@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// NewObjectStore cria o ObjectStore correspondente ao driver informado ("gcs", "s3"
+// ou "local"). O driver vazio equivale a "gcs". As configurações específicas de cada
+// driver são lidas das variáveis de ambiente.
+func NewObjectStore(ctx context.Context, driver string) (ObjectStore, error) {
+	switch driver {
+	case "", "gcs":
+		store, err := NewGCSStore(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "s3":
+		useSSL, _ := strconv.ParseBool(os.Getenv("S3_USE_SSL"))
+		store, err := NewS3Store(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+			os.Getenv("S3_REGION"),
+			useSSL,
+		)
+		if err != nil {
+			return nil, err
+		}
+		partSize, _ := strconv.ParseUint(os.Getenv("S3_PART_SIZE_MB"), 10, 64)
+		store.PartSize = partSize * 1024 * 1024
+		return store, nil
+	case "local":
+		return NewLocalStore(os.Getenv("LOCAL_STORAGE_ROOT")), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage driver: %s", driver)
+}
+
+// NewInputStore cria o ObjectStore do bucket de entrada (INPUTBUCKETNAME) a partir
+// de INPUT_STORAGE_DRIVER.
+func NewInputStore(ctx context.Context) (ObjectStore, error) {
+	return NewObjectStore(ctx, os.Getenv("INPUT_STORAGE_DRIVER"))
+}
+
+// NewOutputStore cria o ObjectStore do bucket de saída (OUTPUTBUCKETNAME) a partir
+// de OUTPUT_STORAGE_DRIVER.
+func NewOutputStore(ctx context.Context) (ObjectStore, error) {
+	return NewObjectStore(ctx, os.Getenv("OUTPUT_STORAGE_DRIVER"))
+}
@@ -0,0 +1,27 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+func TestNewObjectStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("LOCAL_STORAGE_ROOT", "/tmp/buckets")
+	store, err := storage.NewObjectStore(ctx, "local")
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/buckets", store.(*storage.LocalStore).Root)
+
+	t.Setenv("S3_ENDPOINT", "localhost:9000")
+	t.Setenv("S3_PART_SIZE_MB", "16")
+	store, err = storage.NewObjectStore(ctx, "s3")
+	require.Nil(t, err)
+	require.Equal(t, uint64(16*1024*1024), store.(*storage.S3Store).PartSize)
+
+	_, err = storage.NewObjectStore(ctx, "ftp")
+	require.Error(t, err)
+}
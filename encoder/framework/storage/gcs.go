@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore implementa ObjectStore sobre o Google Cloud Storage.
+type GCSStore struct {
+	Client *gcs.Client
+}
+
+// NewGCSStore cria um cliente do GCS usando as credenciais padrão da aplicação
+// (GOOGLE_APPLICATION_CREDENTIALS).
+func NewGCSStore(ctx context.Context) (*GCSStore, error) {
+	client, err := gcs.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSStore{Client: client}, nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	r, err := s.Client.Bucket(bucket).Object(key).NewRangeReader(ctx, offset, -1)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *GCSStore) Put(ctx context.Context, bucket string, key string, r io.Reader, opts PutOptions) error {
+	wc := s.Client.Bucket(bucket).Object(key).NewWriter(ctx)
+	switch opts.ACL {
+	case ACLPublicRead:
+		wc.ACL = []gcs.ACLRule{
+			{
+				Entity: gcs.AllUsers,
+				Role:   gcs.RoleReader,
+			},
+		}
+	case ACLPrivate:
+		wc.PredefinedACL = "private"
+	}
+
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return err
+	}
+
+	return wc.Close()
+}
+
+func (s *GCSStore) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	attrs, err := s.Client.Bucket(bucket).Object(key).Attrs(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return gcsObjectInfo(attrs), nil
+}
+
+func (s *GCSStore) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	it := s.Client.Bucket(bucket).Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *gcsObjectInfo(attrs))
+	}
+
+	return objects, nil
+}
+
+func (s *GCSStore) Delete(ctx context.Context, bucket string, key string) error {
+	err := s.Client.Bucket(bucket).Object(key).Delete(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (s *GCSStore) SignedURL(ctx context.Context, bucket string, key string, expires time.Duration) (string, error) {
+	return s.Client.Bucket(bucket).SignedURL(key, &gcs.SignedURLOptions{
+		Method:  "GET",
+		Scheme:  gcs.SigningSchemeV4,
+		Expires: time.Now().Add(expires),
+	})
+}
+
+func gcsObjectInfo(attrs *gcs.ObjectAttrs) *ObjectInfo {
+	return &ObjectInfo{
+		Key:       attrs.Name,
+		Size:      attrs.Size,
+		MD5:       attrs.MD5,
+		CRC32C:    attrs.CRC32C,
+		HasCRC32C: true,
+		UpdatedAt: attrs.Updated,
+	}
+}
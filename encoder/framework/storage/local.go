@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStore implementa ObjectStore no sistema de arquivos local. Cada bucket é um
+// diretório dentro de Root e cada objeto é um arquivo dentro do bucket. É usado em
+// desenvolvimento e nos testes, dispensando credenciais do GCP.
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{Root: root}
+}
+
+func (s *LocalStore) Get(ctx context.Context, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Put ignora opts.ACL: o sistema de arquivos local não tem controle de acesso por objeto.
+func (s *LocalStore) Put(ctx context.Context, bucket string, key string, r io.Reader, opts PutOptions) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Stat calcula os checksums do arquivo a cada chamada, imitando os metadados do GCS.
+func (s *LocalStore) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := HashReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:       key,
+		Size:      info.Size(),
+		MD5:       h.MD5(),
+		CRC32C:    h.CRC32C(),
+		HasCRC32C: true,
+		UpdatedAt: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	root, err := s.bucketPath(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{
+				Key:       key,
+				Size:      info.Size(),
+				UpdatedAt: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, bucket string, key string) error {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+// SignedURL retorna uma URL file:// para o objeto; a validade não se aplica localmente.
+func (s *LocalStore) SignedURL(ctx context.Context, bucket string, key string, expires time.Duration) (string, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return "", err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(path), nil
+}
+
+// path retorna o arquivo do objeto, rejeitando buckets e nomes que, depois de resolvidos
+// os "..", apontariam para fora de Root/bucket.
+func (s *LocalStore) path(bucket string, key string) (string, error) {
+	root, err := s.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if !within(root, path) || path == root {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return path, nil
+}
+
+// bucketPath retorna o diretório do bucket, rejeitando nomes que apontariam para fora de
+// Root.
+func (s *LocalStore) bucketPath(bucket string) (string, error) {
+	root := filepath.Clean(s.Root)
+	path := filepath.Join(root, bucket)
+	if !within(root, path) {
+		return "", fmt.Errorf("%w: bucket %q", ErrInvalidKey, bucket)
+	}
+	return path, nil
+}
+
+// within informa se path é dir ou está dentro dele. Ambos devem estar limpos.
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
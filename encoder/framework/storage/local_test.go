@@ -0,0 +1,104 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zemartins81/encoderVideoGolang/framework/storage"
+)
+
+func TestLocalStorePutGetStat(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+
+	err := store.Put(ctx, "bucket", "video/segment-1.m4s", strings.NewReader("content"), storage.PutOptions{})
+	require.Nil(t, err)
+
+	info, err := store.Stat(ctx, "bucket", "video/segment-1.m4s")
+	require.Nil(t, err)
+	require.Equal(t, "video/segment-1.m4s", info.Key)
+	require.Equal(t, int64(7), info.Size)
+
+	r, err := store.Get(ctx, "bucket", "video/segment-1.m4s", 0)
+	require.Nil(t, err)
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "content", string(body))
+
+	h, err := storage.HashReader(strings.NewReader("content"))
+	require.Nil(t, err)
+	require.Nil(t, info.Verify(h))
+
+	h, err = storage.HashReader(strings.NewReader("contenT"))
+	require.Nil(t, err)
+	require.Error(t, info.Verify(h))
+}
+
+func TestLocalStoreGetFromOffset(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+
+	require.Nil(t, store.Put(ctx, "bucket", "video.mp4", strings.NewReader("0123456789"), storage.PutOptions{}))
+
+	r, err := store.Get(ctx, "bucket", "video.mp4", 4)
+	require.Nil(t, err)
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	require.Nil(t, err)
+	require.Equal(t, "456789", string(body))
+}
+
+func TestLocalStoreListAndDelete(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+
+	require.Nil(t, store.Put(ctx, "bucket", "a/1.m4s", strings.NewReader("1"), storage.PutOptions{}))
+	require.Nil(t, store.Put(ctx, "bucket", "a/2.m4s", strings.NewReader("2"), storage.PutOptions{}))
+	require.Nil(t, store.Put(ctx, "bucket", "b/1.m4s", strings.NewReader("3"), storage.PutOptions{}))
+
+	objects, err := store.List(ctx, "bucket", "a/")
+	require.Nil(t, err)
+	require.Len(t, objects, 2)
+
+	err = store.Delete(ctx, "bucket", "a/1.m4s")
+	require.Nil(t, err)
+
+	_, err = store.Stat(ctx, "bucket", "a/1.m4s")
+	require.ErrorIs(t, err, storage.ErrObjectNotFound)
+
+	err = store.Delete(ctx, "bucket", "a/1.m4s")
+	require.ErrorIs(t, err, storage.ErrObjectNotFound)
+}
+
+func TestLocalStoreRejectsKeysOutsideTheBucket(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := storage.NewLocalStore(root)
+
+	require.Nil(t, store.Put(ctx, "other", "secret.txt", strings.NewReader("secret"), storage.PutOptions{}))
+
+	_, err := store.Get(ctx, "bucket", "../other/secret.txt", 0)
+	require.ErrorIs(t, err, storage.ErrInvalidKey)
+
+	_, err = store.Stat(ctx, "bucket", "video/../../other/secret.txt")
+	require.ErrorIs(t, err, storage.ErrInvalidKey)
+
+	err = store.Put(ctx, "bucket", "../../escaped.txt", strings.NewReader("content"), storage.PutOptions{})
+	require.ErrorIs(t, err, storage.ErrInvalidKey)
+
+	require.ErrorIs(t, store.Delete(ctx, "..", "other/secret.txt"), storage.ErrInvalidKey)
+
+	_, err = store.List(ctx, "..", "")
+	require.ErrorIs(t, err, storage.ErrInvalidKey)
+
+	// ".." no meio do nome é aceito enquanto o objeto continuar dentro do bucket.
+	require.Nil(t, store.Put(ctx, "bucket", "video/../stream.mpd", strings.NewReader("content"), storage.PutOptions{}))
+	_, err = store.Stat(ctx, "bucket", "stream.mpd")
+	require.Nil(t, err)
+}
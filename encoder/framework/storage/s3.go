@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store implementa ObjectStore para serviços compatíveis com S3 (AWS S3, MinIO).
+// Arquivos maiores que PartSize são enviados com upload multipart.
+type S3Store struct {
+	Client   *minio.Client
+	PartSize uint64
+}
+
+// NewS3Store cria um cliente S3 para o endpoint informado.
+func NewS3Store(endpoint string, accessKey string, secretKey string, region string, useSSL bool) (*S3Store, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{Client: client}, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, bucket string, key string, offset int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if offset > 0 {
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	obj, err := s.Client.GetObject(ctx, bucket, key, opts)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	// GetObject só contacta o servidor na primeira leitura; Stat antecipa o erro
+	// de objeto inexistente.
+	if _, err = obj.Stat(); err != nil {
+		obj.Close()
+		return nil, s3Error(err)
+	}
+	return obj, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, bucket string, key string, r io.Reader, opts PutOptions) error {
+	size := int64(-1)
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	}
+
+	// O CRC32C do objeto inteiro, inclusive em uploads multipart, é conferido pelo
+	// servidor e devolvido por Stat, para que o conteúdo gravado possa ser verificado.
+	putOptions := minio.PutObjectOptions{
+		PartSize:     s.PartSize,
+		AutoChecksum: minio.ChecksumFullObjectCRC32C,
+	}
+	switch opts.ACL {
+	case ACLPublicRead:
+		putOptions.UserMetadata = map[string]string{"x-amz-acl": "public-read"}
+	case ACLPrivate:
+		putOptions.UserMetadata = map[string]string{"x-amz-acl": "private"}
+	}
+
+	_, err := s.Client.PutObject(ctx, bucket, key, r, size, putOptions)
+	return s3Error(err)
+}
+
+func (s *S3Store) Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error) {
+	info, err := s.Client.StatObject(ctx, bucket, key, minio.StatObjectOptions{Checksum: true})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return s3ObjectInfo(info), nil
+}
+
+func (s *S3Store) List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	for info := range s.Client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, s3Error(info.Err)
+		}
+		objects = append(objects, *s3ObjectInfo(info))
+	}
+
+	return objects, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, bucket string, key string) error {
+	if _, err := s.Stat(ctx, bucket, key); err != nil {
+		return err
+	}
+	return s3Error(s.Client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Store) SignedURL(ctx context.Context, bucket string, key string, expires time.Duration) (string, error) {
+	u, err := s.Client.PresignedGetObject(ctx, bucket, key, expires, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func s3ObjectInfo(info minio.ObjectInfo) *ObjectInfo {
+	objectInfo := &ObjectInfo{
+		Key:       info.Key,
+		Size:      info.Size,
+		UpdatedAt: info.LastModified,
+	}
+
+	// O ETag só corresponde ao MD5 do conteúdo em uploads de parte única; uploads
+	// multipart geram ETags no formato "<hash>-<partes>".
+	if !strings.Contains(info.ETag, "-") {
+		objectInfo.MD5, _ = hex.DecodeString(strings.Trim(info.ETag, `"`))
+	}
+
+	// Checksums compostos, no formato "<hash>-<partes>", são calculados sobre os checksums
+	// das partes e não podem ser comparados com o do conteúdo.
+	if crc, err := base64.StdEncoding.DecodeString(info.ChecksumCRC32C); err == nil && len(crc) == 4 {
+		objectInfo.CRC32C = binary.BigEndian.Uint32(crc)
+		objectInfo.HasCRC32C = true
+	}
+
+	return objectInfo
+}
+
+func s3Error(err error) error {
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrObjectNotFound
+	}
+	return err
+}
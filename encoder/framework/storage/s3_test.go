@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"encoding/base64"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ObjectInfoReadsFullObjectCRC32C(t *testing.T) {
+	crc := crc32.Checksum([]byte("content"), crc32.MakeTable(crc32.Castagnoli))
+	encoded := base64.StdEncoding.EncodeToString([]byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)})
+
+	info := s3ObjectInfo(minio.ObjectInfo{Key: "video/stream.mpd", Size: 7, ETag: `"abc-2"`, ChecksumCRC32C: encoded})
+	require.True(t, info.HasCRC32C)
+	require.Equal(t, crc, info.CRC32C)
+	require.Empty(t, info.MD5)
+
+	h, err := HashReader(strings.NewReader("content"))
+	require.Nil(t, err)
+	require.Nil(t, info.Verify(h))
+
+	// Checksums compostos de uploads multipart não são comparáveis com o do conteúdo.
+	composite := s3ObjectInfo(minio.ObjectInfo{Key: "video/stream.mpd", Size: 7, ChecksumCRC32C: encoded + "-2"})
+	require.False(t, composite.HasCRC32C)
+	require.False(t, composite.HasChecksum())
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrObjectNotFound é retornado quando o objeto solicitado não existe no bucket.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrInvalidKey é retornado quando o bucket ou o nome do objeto apontam para fora do
+// armazenamento, como em "../outro-bucket/objeto".
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ACL define quem pode ler os objetos gravados por Put.
+type ACL string
+
+const (
+	// ACLPublicRead torna o objeto legível por qualquer pessoa.
+	ACLPublicRead ACL = "public"
+	// ACLPrivate restringe a leitura ao dono do bucket; o acesso de terceiros é feito
+	// por URLs assinadas.
+	ACLPrivate ACL = "private"
+	// ACLBucketDefault não define permissões no objeto, mantendo a política do bucket.
+	ACLBucketDefault ACL = "bucket-default"
+)
+
+// PutOptions são as opções de gravação de um objeto.
+type PutOptions struct {
+	ACL ACL
+}
+
+// ObjectInfo descreve um objeto armazenado em um bucket. MD5 fica vazio e HasCRC32C
+// falso quando o armazenamento não informa o checksum correspondente.
+type ObjectInfo struct {
+	Key       string
+	Size      int64
+	MD5       []byte
+	CRC32C    uint32
+	HasCRC32C bool
+	UpdatedAt time.Time
+}
+
+// ObjectStore abstrai o serviço de armazenamento de objetos usado pelo pipeline,
+// permitindo trocar o GCS por outra implementação (ex.: sistema de arquivos local).
+type ObjectStore interface {
+	// Get abre o objeto para leitura a partir do byte offset, permitindo retomar
+	// transferências parciais. Quem chama deve fechar o leitor.
+	Get(ctx context.Context, bucket string, key string, offset int64) (io.ReadCloser, error)
+	// Put grava o conteúdo de r no objeto, substituindo-o caso já exista.
+	Put(ctx context.Context, bucket string, key string, r io.Reader, opts PutOptions) error
+	// Stat retorna os metadados do objeto.
+	Stat(ctx context.Context, bucket string, key string) (*ObjectInfo, error)
+	// List retorna os objetos cujo nome começa com prefix.
+	List(ctx context.Context, bucket string, prefix string) ([]ObjectInfo, error)
+	// Delete remove o objeto do bucket.
+	Delete(ctx context.Context, bucket string, key string) error
+}
+
+// URLSigner é implementado pelos armazenamentos capazes de gerar URLs de leitura com
+// prazo de validade para objetos privados.
+type URLSigner interface {
+	SignedURL(ctx context.Context, bucket string, key string, expires time.Duration) (string, error)
+}